@@ -53,10 +53,10 @@ func (l *accountsCommand) list(pc *kingpin.ParseContext) error {
 	if err != nil {
 		return err
 	}
-	out := new(RowFieldOutput)
-	out.Setup(strings.Split(l.Fields, ","))
-
-	out.SendHeader()
+	out, err := l.rowOutput(l.Fields)
+	if err != nil {
+		return err
+	}
 
 	accounts, err := l.Client.Accounts()
 	if err != nil {
@@ -78,13 +78,13 @@ func (l *accountsCommand) list(pc *kingpin.ParseContext) error {
 		}
 	}
 
-	for _, a := range accounts {
-		if err = out.Write(accountFields(account{&a, colmap[a.Id]})); err != nil {
+	for i := range accounts {
+		a := account{&accounts[i], colmap[accounts[i].Id]}
+		if err = out.Write(accountFields(a), a); err != nil {
 			return err
 		}
 	}
-	out.Flush()
-	return nil
+	return out.Flush()
 }
 
 func (l *accountsCommand) show(pc *kingpin.ParseContext) error {
@@ -92,9 +92,14 @@ func (l *accountsCommand) show(pc *kingpin.ParseContext) error {
 	if err != nil {
 		return err
 	}
-	out := new(ShowFieldOutput)
-	out.Setup(strings.Split(l.Fields, ","))
-
+	l.Id, err = l.Client.accountResolver().resolve(l.Id)
+	if err != nil {
+		return err
+	}
+	out, err := l.showOutput(l.Fields)
+	if err != nil {
+		return err
+	}
 	a, err := l.Client.Account(l.Id)
 	if err != nil {
 		return err
@@ -108,11 +113,11 @@ func (l *accountsCommand) show(pc *kingpin.ParseContext) error {
 		}
 	}
 
-	if err = out.Write(accountFields(account{a, colmap[a.Id]})); err != nil {
+	acc := account{a, colmap[a.Id]}
+	if err = out.Write(accountFields(acc), acc); err != nil {
 		return err
 	}
-	out.Flush()
-	return nil
+	return out.Flush()
 }
 
 func configureAccountsCommand(app *CLIApp) {
@@ -120,12 +125,13 @@ func configureAccountsCommand(app *CLIApp) {
 	accounts := app.Command("accounts", "manage accounts")
 
 	list := accounts.Command("list", "list accounts").Default().Action(cmd.list)
+	app.listFlags(list)
 	list.Flag("fields", "Which fields to display").
 		Default(strings.Join(defaultAccountListFields, ",")).
 		StringVar(&cmd.Fields)
 
 	show := accounts.Command("show", "Show detailed account info").Action(cmd.show)
-	show.Arg("identifier", "Identifier of account to show").
+	show.Arg("identifier", "Identifier or name of account to show").
 		Required().StringVar(&cmd.Id)
 
 	show.Flag("fields", "Which fields to display").
@@ -0,0 +1,87 @@
+package cli
+
+import (
+	"fmt"
+	"gopkg.in/alecthomas/kingpin.v2"
+	"os"
+	"time"
+)
+
+type manifestCommand struct {
+	*CLIApp
+	File             string
+	Prune            bool
+	Timeout          time.Duration
+	DetailedExitcode bool
+	Color            string
+}
+
+// planManifest reads the manifest and works out the actions needed to apply
+// it, printing any warnings about differences that can't be applied
+func (l *manifestCommand) planManifest() ([]*planAction, error) {
+	m, err := readManifest(l.File)
+	if err != nil {
+		return nil, err
+	}
+	st, err := l.Client.fetchLiveState()
+	if err != nil {
+		return nil, err
+	}
+	if l.Timeout > 0 {
+		st.timeout = l.Timeout
+	}
+	actions, err := st.plan(m, l.Prune)
+	if err != nil {
+		return nil, err
+	}
+	for _, w := range st.warnings {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", w)
+	}
+	return actions, nil
+}
+
+func (l *manifestCommand) apply(pc *kingpin.ParseContext) error {
+	err := l.Configure()
+	if err != nil {
+		return err
+	}
+	actions, err := l.planManifest()
+	if err != nil {
+		return err
+	}
+	if len(actions) == 0 {
+		fmt.Println("No changes to apply")
+		return nil
+	}
+	done := make(map[string]int)
+	for _, a := range actions {
+		if a.Id != "" {
+			fmt.Printf("%s %s %s (%s)\n", planActionVerbs[a.Action], a.Kind, a.Name, a.Id)
+		} else {
+			fmt.Printf("%s %s %s\n", planActionVerbs[a.Action], a.Kind, a.Name)
+		}
+		if err := a.run(); err != nil {
+			return fmt.Errorf("%s %s %s: %s", a.Action, a.Kind, a.Name, err.Error())
+		}
+		done[a.Action]++
+	}
+	fmt.Printf("Applied: %d created, %d updated, %d destroyed\n", done["create"], done["update"], done["destroy"])
+	return nil
+}
+
+// manifestFlags adds the flags shared by commands that work from a manifest
+func (l *manifestCommand) manifestFlags(cmd *kingpin.CmdClause) {
+	cmd.Flag("file", "Manifest of resources, in YAML or JSON, or - for stdin").
+		Short('f').Required().StringVar(&l.File)
+	cmd.Flag("prune", "Destroy resources named with the manifest's label that it doesn't list").
+		BoolVar(&l.Prune)
+}
+
+func configureApplyCommand(app *CLIApp) {
+	cmd := manifestCommand{CLIApp: app}
+	apply := app.Command("apply", "Create, update and destroy resources to match a manifest").
+		Action(cmd.apply)
+	cmd.manifestFlags(apply)
+	apply.Flag("timeout", "How long to wait for Cloud IPs to unmap before giving up").
+		Default("2m").DurationVar(&cmd.Timeout)
+}
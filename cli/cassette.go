@@ -0,0 +1,241 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+const redacted = "[REDACTED]"
+
+// sensitiveFields are the JSON and form fields redacted from recorded and
+// logged request and response bodies
+var sensitiveFields = map[string]bool{
+	"secret":               true,
+	"password":             true,
+	"client_secret":        true,
+	"admin_password":       true,
+	"library_ftp_password": true,
+	"access_token":         true,
+	"refresh_token":        true,
+	"console_token":        true,
+}
+
+// redactHeaders copies headers, redacting any credentials
+func redactHeaders(h http.Header) http.Header {
+	out := make(http.Header)
+	for k, v := range h {
+		if k == "Authorization" {
+			v = []string{strings.SplitN(v[0], " ", 2)[0] + " " + redacted}
+		}
+		out[k] = v
+	}
+	return out
+}
+
+// redactBody redacts the values of sensitive fields anywhere in a JSON body,
+// or in a form, such as OAuth token requests. Other bodies are returned as
+// they are.
+func redactBody(contentType string, body []byte) []byte {
+	if strings.HasPrefix(contentType, "application/x-www-form-urlencoded") {
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			return body
+		}
+		for k := range form {
+			if sensitiveFields[k] {
+				form.Set(k, redacted)
+			}
+		}
+		return []byte(form.Encode())
+	}
+	var v interface{}
+	if len(body) == 0 || json.Unmarshal(body, &v) != nil {
+		return body
+	}
+	redacted, err := json.Marshal(redactValue(v))
+	if err != nil {
+		return body
+	}
+	return redacted
+}
+
+func redactValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, value := range v {
+			if sensitiveFields[k] && value != nil {
+				v[k] = redacted
+			} else {
+				v[k] = redactValue(value)
+			}
+		}
+	case []interface{}:
+		for i, value := range v {
+			v[i] = redactValue(value)
+		}
+	}
+	return v
+}
+
+// readBody reads a request or response body, leaving it to be read again
+func readBody(body *io.ReadCloser) ([]byte, error) {
+	if *body == nil {
+		return nil, nil
+	}
+	data, err := ioutil.ReadAll(*body)
+	(*body).Close()
+	*body = ioutil.NopCloser(bytes.NewReader(data))
+	return data, err
+}
+
+// cassette is a recording of API requests and their responses, saved as JSON
+type cassette struct {
+	Interactions []cassetteInteraction `json:"interactions"`
+}
+
+type cassetteInteraction struct {
+	Request  cassetteRequest  `json:"request"`
+	Response cassetteResponse `json:"response"`
+	used     bool
+}
+
+type cassetteRequest struct {
+	Method  string      `json:"method"`
+	URL     string      `json:"url"`
+	Headers http.Header `json:"headers,omitempty"`
+	Body    string      `json:"body,omitempty"`
+}
+
+type cassetteResponse struct {
+	Status  int         `json:"status"`
+	Headers http.Header `json:"headers,omitempty"`
+	Body    string      `json:"body,omitempty"`
+}
+
+// cassetteRecorder is a transport that records every request and response
+// to a cassette file, with credentials redacted. The file is saved after each
+// response, so it is complete even if the command exits early.
+type cassetteRecorder struct {
+	Filename  string
+	Transport http.RoundTripper
+	mu        sync.Mutex
+	cassette  cassette
+}
+
+func (c *cassetteRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	reqBody, err := readBody(&req.Body)
+	if err != nil {
+		return nil, err
+	}
+	res, err := c.Transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	resBody, err := readBody(&res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	// Redacted bodies may not be the length they were
+	resHeaders := redactHeaders(res.Header)
+	resHeaders.Del("Content-Length")
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cassette.Interactions = append(c.cassette.Interactions, cassetteInteraction{
+		Request: cassetteRequest{
+			Method:  req.Method,
+			URL:     req.URL.String(),
+			Headers: redactHeaders(req.Header),
+			Body:    string(redactBody(req.Header.Get("Content-Type"), reqBody)),
+		},
+		Response: cassetteResponse{
+			Status:  res.StatusCode,
+			Headers: resHeaders,
+			Body:    string(redactBody(res.Header.Get("Content-Type"), resBody)),
+		},
+	})
+	data, err := json.MarshalIndent(&c.cassette, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err = writeFileAtomically(c.Filename, append(data, '\n'), 0600); err != nil {
+		return nil, fmt.Errorf("Couldn't save cassette: %s", err.Error())
+	}
+	return res, nil
+}
+
+// cassettePlayer is a transport that replays the responses in a cassette
+// instead of making requests. Each request gets the first response recorded
+// for the same request which hasn't been replayed yet: the same method, path,
+// query parameters in any order, and body once redacted. The host is ignored,
+// so cassettes can be replayed without the config they were recorded with.
+type cassettePlayer struct {
+	mu       sync.Mutex
+	cassette cassette
+}
+
+func loadCassette(filename string) (*cassettePlayer, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	p := new(cassettePlayer)
+	if err = json.Unmarshal(data, &p.cassette); err != nil {
+		return nil, fmt.Errorf("%s: %s", filename, err.Error())
+	}
+	return p, nil
+}
+
+func (p *cassettePlayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readBody(&req.Body)
+	if err != nil {
+		return nil, err
+	}
+	body = redactBody(req.Header.Get("Content-Type"), body)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	differs := false
+	for i := range p.cassette.Interactions {
+		in := &p.cassette.Interactions[i]
+		if in.used || in.Request.Method != req.Method {
+			continue
+		}
+		recorded, err := req.URL.Parse(in.Request.URL)
+		if err != nil || recorded.Path != req.URL.Path {
+			continue
+		}
+		if recorded.Query().Encode() != req.URL.Query().Encode() || in.Request.Body != string(body) {
+			differs = true
+			continue
+		}
+		in.used = true
+		res := &http.Response{
+			Status:        fmt.Sprintf("%d %s", in.Response.Status, http.StatusText(in.Response.Status)),
+			StatusCode:    in.Response.Status,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        in.Response.Headers,
+			Body:          ioutil.NopCloser(strings.NewReader(in.Response.Body)),
+			ContentLength: int64(len(in.Response.Body)),
+			Request:       req,
+		}
+		if res.Header == nil {
+			res.Header = make(http.Header)
+		}
+		return res, nil
+	}
+	if differs {
+		return nil, fmt.Errorf("No recorded response for %s %s: the recorded requests to it had other query parameters or bodies", req.Method, req.URL.RequestURI())
+	}
+	return nil, fmt.Errorf("No recorded response left for %s %s", req.Method, req.URL.RequestURI())
+}
@@ -0,0 +1,131 @@
+package cli
+
+import (
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRedactBody(t *testing.T) {
+	tests := []struct {
+		contentType string
+		body        string
+		want        string
+	}{
+		{"application/json", `{"id":"srv-aaaaa","name":"web"}`, `{"id":"srv-aaaaa","name":"web"}`},
+		{"application/json", `{"access_token":"abc","expires_in":7200}`, `{"access_token":"[REDACTED]","expires_in":7200}`},
+		{"application/json", `[{"admin_password":"pw","servers":[{"console_token":"t"}]}]`, `[{"admin_password":"[REDACTED]","servers":[{"console_token":"[REDACTED]"}]}]`},
+		{"application/json", `{"library_ftp_password":null}`, `{"library_ftp_password":null}`},
+		{"", `{"secret":"s"}`, `{"secret":"[REDACTED]"}`},
+		{"application/x-www-form-urlencoded", "client_id=cli-aaaaa&client_secret=s&grant_type=client_credentials", "client_id=cli-aaaaa&client_secret=%5BREDACTED%5D&grant_type=client_credentials"},
+		{"application/x-www-form-urlencoded; charset=utf-8", "grant_type=password&password=pw&username=u", "grant_type=password&password=%5BREDACTED%5D&username=u"},
+		{"text/plain", "password=pw", "password=pw"},
+		{"application/json", "not json", "not json"},
+		{"application/json", "", ""},
+	}
+	for _, test := range tests {
+		if got := string(redactBody(test.contentType, []byte(test.body))); got != test.want {
+			t.Errorf("redactBody(%q, %q) = %q, want %q", test.contentType, test.body, got, test.want)
+		}
+	}
+}
+
+func TestRedactHeaders(t *testing.T) {
+	h := http.Header{
+		"Authorization": {"Bearer abcdef"},
+		"Content-Type":  {"application/json"},
+	}
+	got := redactHeaders(h)
+	want := http.Header{
+		"Authorization": {"Bearer [REDACTED]"},
+		"Content-Type":  {"application/json"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if h.Get("Authorization") != "Bearer abcdef" {
+		t.Error("the original headers were changed")
+	}
+}
+
+func TestCassettePlayer(t *testing.T) {
+	p := &cassettePlayer{cassette: cassette{Interactions: []cassetteInteraction{
+		{Request: cassetteRequest{Method: "GET", URL: "https://api.gb1.brightbox.com/1.0/servers?account_id=acc-aaaaa&limit=10"}, Response: cassetteResponse{Status: 200, Body: "first"}},
+		{Request: cassetteRequest{Method: "POST", URL: "https://api.gb1.brightbox.com/1.0/servers", Body: `{"image":"img-aaaaa","name":"web"}`}, Response: cassetteResponse{Status: 202, Body: "created"}},
+		{Request: cassetteRequest{Method: "GET", URL: "https://api.gb1.brightbox.com/1.0/servers"}, Response: cassetteResponse{Status: 200, Body: "second"}},
+	}}}
+	tests := []struct {
+		method, url, body string
+		status            int
+		want              string
+		err               string
+	}{
+		{"GET", "https://api.gb1.brightbox.com/1.0/servers?account_id=acc-bbbbb&limit=10", "", 0, "", "had other query parameters or bodies"},
+		{"GET", "http://localhost:8080/1.0/servers?limit=10&account_id=acc-aaaaa", "", 200, "first", ""},
+		{"GET", "https://api.gb1.brightbox.com/1.0/servers", "", 200, "second", ""},
+		{"POST", "https://api.gb1.brightbox.com/1.0/servers", `{"name":"db","image":"img-aaaaa"}`, 0, "", "had other query parameters or bodies"},
+		{"POST", "https://api.gb1.brightbox.com/1.0/servers", `{"name":"web","image":"img-aaaaa"}`, 202, "created", ""},
+		{"GET", "https://api.gb1.brightbox.com/1.0/servers", "", 0, "", "No recorded response left for GET /1.0/servers"},
+		{"GET", "https://api.gb1.brightbox.com/1.0/images", "", 0, "", "No recorded response left for GET /1.0/images"},
+	}
+	for _, test := range tests {
+		req, _ := http.NewRequest(test.method, test.url, strings.NewReader(test.body))
+		req.Header.Set("Content-Type", "application/json")
+		res, err := p.RoundTrip(req)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s %s: got error %v, want %q", test.method, test.url, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s %s: unexpected error: %s", test.method, test.url, err)
+			continue
+		}
+		body, _ := ioutil.ReadAll(res.Body)
+		if res.StatusCode != test.status || string(body) != test.want {
+			t.Errorf("%s %s: got %d %q, want %d %q", test.method, test.url, res.StatusCode, body, test.status, test.want)
+		}
+	}
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	e := newTestEnv(t)
+	defer e.close()
+	e.mustRun("servers", "create", "--name", "web-1", "img-fake1")
+	cassette := e.dir + "/servers.json"
+
+	// With an empty token cache, the token request is recorded too
+	e.setenv("XDG_CACHE_HOME", e.dir+"/record-cache")
+	recorded := e.mustRun("--record", cassette, "servers", "list")
+	data, err := ioutil.ReadFile(cassette)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`"url": "` + e.api.URL + `/token"`, `"url": "` + e.api.URL + `/1.0/servers`, `"Basic [REDACTED]"`, `"access_token\":\"[REDACTED]\"`} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("cassette doesn't contain %s:\n%s", want, data)
+		}
+	}
+	if strings.Contains(string(data), "secret") {
+		t.Errorf("cassette contains the client secret:\n%s", data)
+	}
+
+	// Without the API or a cached token, everything comes from the cassette
+	e.api.Close()
+	e.setenv("XDG_CACHE_HOME", e.dir+"/replay-cache")
+	if replayed := e.mustRun("--replay", cassette, "servers", "list"); replayed != recorded {
+		t.Errorf("replayed %q, recorded %q", replayed, recorded)
+	}
+	if token := e.mustRun("--replay", cassette, "--format", "json", "token", "create"); !strings.Contains(token, `"access_token": "replay"`) {
+		t.Errorf("got token %q, want the replay token", token)
+	}
+	if _, err := e.run("--replay", cassette, "images", "list"); err == nil {
+		t.Error("expected an error replaying a request that wasn't recorded")
+	}
+	if _, err := e.run("--replay", cassette, "--account", "acc-zzzzz", "servers", "list"); err == nil {
+		t.Error("expected an error replaying a request for another account")
+	}
+}
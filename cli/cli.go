@@ -2,7 +2,10 @@ package cli
 
 import (
 	"errors"
+	"fmt"
 	"gopkg.in/alecthomas/kingpin.v2"
+	"net/http"
+	"os"
 	"strings"
 )
 
@@ -10,13 +13,33 @@ var (
 	errGeneric = errors.New("Errors were encountered")
 )
 
+// ExitStatus is returned by commands that succeed but need to exit with a
+// status other than 0, such as plan with --detailed-exitcode
+type ExitStatus int
+
+func (e ExitStatus) Error() string {
+	return fmt.Sprintf("exit status %d", int(e))
+}
+
 // CLIApp represents a cli application instance
 type CLIApp struct {
 	*kingpin.Application
 	ClientName string
 	AccountId  string
+	Format     string
+	Raw        bool
+	Template   string
+	JSONPath   string
+	Filter     string
+	Sort       string
+	Reverse    bool
+	Limit      int
+	Record     string
+	Replay     string
+	Debug      bool
 	Config     *config
 	Client     *Client
+	transport  http.RoundTripper
 }
 
 // New initializes the brightbox cli application
@@ -25,6 +48,13 @@ func New() *CLIApp {
 	a.Application = kingpin.New("brightbox", "Bleh")
 	a.Flag("client", "client to authenticate with.").OverrideDefaultFromEnvar("CLIENT").StringVar(&a.ClientName)
 	a.Flag("account", "id of account to limit queries to").OverrideDefaultFromEnvar("ACCOUNT").StringVar(&a.AccountId)
+	a.Flag("format", "output format: "+strings.Join(outputFormats, ", ")).Default("text").StringVar(&a.Format)
+	a.Flag("raw", "output full API objects rather than the chosen fields, with json or yaml format").BoolVar(&a.Raw)
+	a.Flag("template", "output each resource using a Go template, e.g: '{{.id}} {{.name}}'").StringVar(&a.Template)
+	a.Flag("jsonpath", "output each resource using a JSONPath template, e.g: '{.id} {.name}'. Use with --raw to reach nested values.").StringVar(&a.JSONPath)
+	a.Flag("record", "record API requests and responses to a cassette file, with credentials redacted").PlaceHolder("FILE").StringVar(&a.Record)
+	a.Flag("replay", "replay API responses from a cassette file made with --record, without using the network").PlaceHolder("FILE").StringVar(&a.Replay)
+	a.Flag("debug", "log API requests and responses to stderr, with credentials masked").OverrideDefaultFromEnvar("BRIGHTBOX_DEBUG").BoolVar(&a.Debug)
 
 	configureServersCommand(a)
 	configureConfigCommand(a)
@@ -33,8 +63,16 @@ func New() *CLIApp {
 	configureTokenCommand(a)
 	configureImagesCommand(a)
 	configureCloudIPsCommand(a)
+	configureFirewallCommand(a)
+	configureLoadBalancersCommand(a)
+	configureSqlCommand(a)
+	configureInventoryCommand(a)
+	configureApplyCommand(a)
+	configurePlanCommand(a)
+	configureExportCommand(a)
 	configureEventsCommand(a)
 	configureLoginCommand(a)
+	configureDevCommand(a)
 	return a
 }
 
@@ -45,17 +83,27 @@ func (c *CLIApp) Configure() error {
 	}
 	c.Config = cfg
 
+	transport, err := c.httpTransport()
+	if err != nil {
+		return err
+	}
+
 	clientName := c.ClientName
 	if clientName == "" {
 		clientName = cfg.defaultClientName
 	}
-	if clientName == "" {
+	if clientName == "" && c.Replay != "" {
+		// Cassettes can be replayed without any client config
+		cfg.currentClient = &Client{ClientName: "replay"}
+	} else if clientName == "" {
 		return nil
+	} else {
+		err = cfg.setClient(clientName)
+		if err != nil {
+			return err
+		}
 	}
-	err = cfg.setClient(clientName)
-	if err != nil {
-		return err
-	}
+	cfg.CurrentClient().transport = transport
 	err = cfg.CurrentClient().Setup(c.AccountId)
 	if err != nil {
 		return err
@@ -64,6 +112,33 @@ func (c *CLIApp) Configure() error {
 	return nil
 }
 
+// httpTransport is the transport API requests are made with, which records
+// or replays them when asked to with --record or --replay, and logs them with
+// --debug
+func (c *CLIApp) httpTransport() (http.RoundTripper, error) {
+	if c.transport != nil {
+		return c.transport, nil
+	}
+	switch {
+	case c.Record != "" && c.Replay != "":
+		return nil, fmt.Errorf("Only one of --record and --replay can be given")
+	case c.Record != "":
+		c.transport = &cassetteRecorder{Filename: c.Record, Transport: http.DefaultTransport}
+	case c.Replay != "":
+		player, err := loadCassette(c.Replay)
+		if err != nil {
+			return nil, err
+		}
+		c.transport = player
+	default:
+		c.transport = http.DefaultTransport
+	}
+	if c.Debug {
+		c.transport = &debugTransport{Transport: c.transport, Writer: os.Stderr}
+	}
+	return c.transport, nil
+}
+
 // Try to get an account id for the connection, either as specified in the
 // config or by looking up the api client id
 func (c *CLIApp) accountId() string {
@@ -0,0 +1,248 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/brightbox/gobrightbox-cli/fakeapi"
+	"io"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testEnv runs commands against a fake API, with the config and token cache
+// kept in a temporary directory
+type testEnv struct {
+	t   *testing.T
+	dir string
+	api *httptest.Server
+	env map[string]string
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	dir, err := ioutil.TempDir("", "brightbox-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := &testEnv{t: t, dir: dir, api: httptest.NewServer(fakeapi.New()), env: make(map[string]string)}
+	e.setenv("HOME", dir)
+	e.setenv("XDG_CONFIG_HOME", filepath.Join(dir, "config"))
+	e.setenv("XDG_CACHE_HOME", filepath.Join(dir, "cache"))
+	e.setenv("CLIENT", "")
+	e.setenv("ACCOUNT", "")
+
+	config := filepath.Join(dir, "config", "brightbox", "config")
+	if err = os.MkdirAll(filepath.Dir(config), 0700); err != nil {
+		t.Fatal(err)
+	}
+	data := fmt.Sprintf("[fake]\nclient_id = cli-fake1\nsecret = secret\napi_url = %s\n", e.api.URL)
+	if err = ioutil.WriteFile(config, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+// setenv sets an environment variable until the test finishes
+func (e *testEnv) setenv(key, value string) {
+	if _, ok := e.env[key]; !ok {
+		e.env[key] = os.Getenv(key)
+	}
+	os.Setenv(key, value)
+}
+
+func (e *testEnv) close() {
+	e.api.Close()
+	for key, value := range e.env {
+		os.Setenv(key, value)
+	}
+	os.RemoveAll(e.dir)
+}
+
+// run runs a command, returning what it wrote to stdout
+func (e *testEnv) run(args ...string) (string, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	output := make(chan string)
+	go func() {
+		var b bytes.Buffer
+		io.Copy(&b, r)
+		output <- b.String()
+	}()
+	_, err = New().Parse(args)
+	os.Stdout = stdout
+	w.Close()
+	return <-output, err
+}
+
+// mustRun runs a command that should succeed
+func (e *testEnv) mustRun(args ...string) string {
+	out, err := e.run(args...)
+	if err != nil {
+		e.t.Fatalf("%s: %s", strings.Join(args, " "), err)
+	}
+	return out
+}
+
+func (e *testEnv) writeFile(name, data string) string {
+	filename := filepath.Join(e.dir, name)
+	if err := ioutil.WriteFile(filename, []byte(data), 0600); err != nil {
+		e.t.Fatal(err)
+	}
+	return filename
+}
+
+func (e *testEnv) serverNames() []string {
+	var servers []map[string]string
+	out := e.mustRun("--format", "json", "servers", "list", "--fields", "id,name")
+	if err := json.Unmarshal([]byte(out), &servers); err != nil {
+		e.t.Fatalf("%s: %q", err, out)
+	}
+	var names []string
+	for _, s := range servers {
+		names = append(names, s["name"])
+	}
+	return names
+}
+
+func TestServersCreateListDestroy(t *testing.T) {
+	e := newTestEnv(t)
+	defer e.close()
+
+	out := e.mustRun("servers", "create", "--name", "web-1", "img-fake1")
+	if !strings.Contains(out, "web-1") || !strings.Contains(out, "srv-") {
+		t.Errorf("got create output %q", out)
+	}
+	e.mustRun("servers", "create", "--name", "web-2", "ubuntu-jammy")
+	if names := e.serverNames(); strings.Join(names, ",") != "web-1,web-2" {
+		t.Errorf("got servers %v, want web-1 and web-2", names)
+	}
+
+	out = e.mustRun("--format", "csv", "servers", "list", "--fields", "name,status", "--filter", "name=web-2")
+	if out != "name,status\nweb-2,active\n" {
+		t.Errorf("got filtered list %q", out)
+	}
+
+	e.mustRun("servers", "destroy", "web-1")
+	if names := e.serverNames(); strings.Join(names, ",") != "web-2" {
+		t.Errorf("got servers %v after destroying web-1, want web-2", names)
+	}
+	if _, err := e.run("servers", "destroy", "web-1"); err == nil {
+		t.Error("expected an error destroying a server that's gone")
+	}
+}
+
+const testManifest = `
+label: test-
+server_groups:
+  - name: test-web
+    description: Web servers
+servers:
+  - name: test-web-1
+    image: img-fake1
+    groups: [test-web]
+`
+
+func TestPlanAndApply(t *testing.T) {
+	e := newTestEnv(t)
+	defer e.close()
+	manifest := e.writeFile("infra.yaml", testManifest)
+
+	out, err := e.run("plan", "-f", manifest, "--detailed-exitcode", "--color", "never")
+	if status, ok := err.(ExitStatus); !ok || status != 2 {
+		t.Errorf("got error %v, want exit status 2", err)
+	}
+	if !strings.Contains(out, "+ server group test-web") || !strings.Contains(out, "+ server test-web-1") {
+		t.Errorf("got plan %q", out)
+	}
+
+	e.mustRun("apply", "-f", manifest)
+	if names := e.serverNames(); strings.Join(names, ",") != "test-web-1" {
+		t.Errorf("got servers %v after apply, want test-web-1", names)
+	}
+
+	out, err = e.run("plan", "-f", manifest, "--detailed-exitcode")
+	if err != nil {
+		t.Errorf("got error %v, want none once applied", err)
+	}
+	if !strings.Contains(out, "No changes") {
+		t.Errorf("got plan %q, want no changes", out)
+	}
+}
+
+func TestExport(t *testing.T) {
+	e := newTestEnv(t)
+	defer e.close()
+	e.mustRun("apply", "-f", e.writeFile("infra.yaml", testManifest))
+
+	out := e.mustRun("export", "--label", "test-", "--resources", "groups,servers")
+	exported := e.writeFile("exported.yaml", out)
+	m, err := readManifest(exported)
+	if err != nil {
+		t.Fatalf("%s: %q", err, out)
+	}
+	if len(m.ServerGroups) != 1 || len(m.Servers) != 1 || m.Servers[0].Groups[0] != "test-web" {
+		t.Errorf("got manifest %+v", m)
+	}
+
+	out = e.mustRun("--format", "json", "export", "--resources", "groups")
+	if !json.Valid([]byte(out)) {
+		t.Errorf("got invalid json %q", out)
+	}
+	for _, format := range []string{"csv", "tsv"} {
+		if _, err := e.run("--format", format, "export"); err == nil {
+			t.Errorf("expected an error exporting as %s", format)
+		}
+	}
+}
+
+func TestTokenCreate(t *testing.T) {
+	e := newTestEnv(t)
+	defer e.close()
+	out := e.mustRun("--format", "json", "token", "create")
+	var token map[string]interface{}
+	if err := json.Unmarshal([]byte(out), &token); err != nil {
+		t.Fatalf("%s: %q", err, out)
+	}
+	for _, field := range []string{"access_token", "token_type", "expiry"} {
+		if token[field] == nil {
+			t.Errorf("token has no %s: %q", field, out)
+		}
+	}
+}
+
+func TestCloudIPsUpdatePortTranslators(t *testing.T) {
+	e := newTestEnv(t)
+	defer e.close()
+
+	e.mustRun("cloudips", "create", "--name", "web-ip", "-t", "80:8080:tcp,443:8443:tcp")
+	show := func() string {
+		return e.mustRun("--format", "csv", "cloudips", "show", "web-ip", "--fields", "port_translators")
+	}
+	if out := show(); out != "port_translators\n\"80:8080:tcp,443:8443:tcp\"\n" {
+		t.Errorf("got %q after create", out)
+	}
+	e.mustRun("cloudips", "update", "web-ip", "-t", "80:80:http")
+	if out := show(); out != "port_translators\n80:80:http\n" {
+		t.Errorf("got %q after update", out)
+	}
+	e.mustRun("cloudips", "update", "web-ip", "-t", "")
+	if out := show(); out != "port_translators\n\n" {
+		t.Errorf("got %q after removing them", out)
+	}
+
+	// A manifest without port translators removes them, and then agrees
+	manifest := e.writeFile("infra.yaml", "cloud_ips:\n  - name: web-ip\n    port_translators: \"\"\n")
+	e.mustRun("cloudips", "update", "web-ip", "-t", "80:80:http")
+	e.mustRun("apply", "-f", manifest)
+	if out, err := e.run("plan", "-f", manifest, "--detailed-exitcode"); err != nil || !strings.Contains(out, "No changes") {
+		t.Errorf("got plan %q and error %v, want no changes once applied", out, err)
+	}
+}
@@ -1,8 +1,10 @@
 package cli
 
 import (
+	"context"
 	"github.com/brightbox/gobrightbox"
 	"golang.org/x/oauth2"
+	"net/http"
 	"net/url"
 	"strings"
 )
@@ -20,6 +22,7 @@ type Client struct {
 	Username       string `ini:"username"`
 	tokenCache     *TokenCacher
 	tokenSource    oauth2.TokenSource
+	transport      http.RoundTripper
 }
 
 func (c *Client) TokenCache() *TokenCacher {
@@ -29,8 +32,10 @@ func (c *Client) TokenCache() *TokenCacher {
 	return c.tokenCache
 }
 
+// Setup creates the API client, authenticating its requests with OAuth
+// tokens and making them with the client's transport, if it has one.
 func (c *Client) Setup(accountId string) error {
-	tc := oauth2.NewClient(oauth2.NoContext, c.TokenSource())
+	tc := oauth2.NewClient(c.httpContext(), c.TokenSource())
 	if accountId == "" {
 		accountId = c.DefaultAccount
 	}
@@ -42,6 +47,26 @@ func (c *Client) Setup(accountId string) error {
 	return nil
 }
 
+// httpContext is the context OAuth requests are made with, which makes them
+// with the client's transport, if it has one
+func (c *Client) httpContext() context.Context {
+	if c.transport == nil {
+		return oauth2.NoContext
+	}
+	return context.WithValue(oauth2.NoContext, oauth2.HTTPClient, &http.Client{Transport: c.transport})
+}
+
+// replaying is whether the client's requests are replayed from a cassette,
+// whether or not they are also logged with --debug
+func (c *Client) replaying() bool {
+	transport := c.transport
+	if debug, ok := transport.(*debugTransport); ok {
+		transport = debug.Transport
+	}
+	_, ok := transport.(*cassettePlayer)
+	return ok
+}
+
 func (c *Client) findAuthUrl() string {
 	var err error
 	var u *url.URL
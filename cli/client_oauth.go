@@ -6,9 +6,17 @@ import (
 	"golang.org/x/oauth2/clientcredentials"
 )
 
+// replayToken stands in for OAuth tokens while replaying a cassette, since
+// replayed responses don't need a real one
+var replayToken = &oauth2.Token{AccessToken: "replay", TokenType: "Bearer"}
+
 // Token returns the cached OAuth token from disk if it's still valid, or
-// retrieves a new one from the token source.
+// retrieves a new one from the token source. Replayed tokens are neither
+// read from nor written to the cache.
 func (c *Client) Token() (*oauth2.Token, error) {
+	if c.replaying() {
+		return replayToken, nil
+	}
 	token := c.TokenCache().Read()
 	if token != nil && token.Valid() == true {
 		return token, nil
@@ -54,12 +62,41 @@ func (c *Client) TokenSource() oauth2.TokenSource {
 	if c.tokenSource != nil {
 		return c
 	}
+	if c.replaying() {
+		c.tokenSource = oauth2.StaticTokenSource(replayToken)
+		return c
+	}
 	oc := c.oauthConfig()
 	switch oc := oc.(type) {
 	case oauth2.Config:
-		c.tokenSource = oc.TokenSource(oauth2.NoContext, c.TokenCache().Read())
+		c.tokenSource = oc.TokenSource(c.httpContext(), c.TokenCache().Read())
 	case clientcredentials.Config:
-		c.tokenSource = oc.TokenSource(oauth2.NoContext)
+		c.tokenSource = oc.TokenSource(c.httpContext())
 	}
 	return c
 }
+
+// RefreshToken gets a new OAuth token even if the cached one is still valid,
+// for long running commands that need one which won't expire soon. Password
+// auth credentials use the cached refresh token.
+func (c *Client) RefreshToken() (*oauth2.Token, error) {
+	if c.replaying() {
+		return replayToken, nil
+	}
+	switch oc := c.oauthConfig().(type) {
+	case oauth2.Config:
+		cached := c.TokenCache().Read()
+		if cached == nil || cached.RefreshToken == "" {
+			return nil, fmt.Errorf("No refresh token cached for %s, please login again", c.ClientName)
+		}
+		c.tokenSource = oc.TokenSource(c.httpContext(), &oauth2.Token{RefreshToken: cached.RefreshToken})
+	case clientcredentials.Config:
+		c.tokenSource = oc.TokenSource(c.httpContext())
+	}
+	token, err := c.tokenSource.Token()
+	if err != nil {
+		return nil, err
+	}
+	c.TokenCache().Write(token)
+	return token, nil
+}
@@ -0,0 +1,62 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A resource to which a Cloud IP can be mapped
+type cloudIPDestination struct {
+	Id   string
+	Kind string
+}
+
+var cloudIPDestinationPrefixes = map[string]string{
+	"srv-": "server",
+	"int-": "interface",
+	"lba-": "load balancer",
+	"dbs-": "database server",
+	"grp-": "server group",
+}
+
+// resolveCloudIPDestination works out what kind of resource a Cloud IP is to
+// be mapped to, either by its identifier prefix or by looking for a server,
+// load balancer, database server or server group with that name, as a
+// resolver would. Deleted resources are ignored.
+func (c *Client) resolveCloudIPDestination(handle string) (*cloudIPDestination, error) {
+	if handle == "" {
+		return nil, fmt.Errorf("No Cloud IP destination given")
+	}
+	r := &resolver{
+		Kind:     "server, load balancer, database server or server group",
+		Prefixes: []string{"srv-", "int-", "lba-", "dbs-", "grp-"},
+		List:     c.cloudIPDestinationHandles,
+	}
+	id, err := r.resolve(handle)
+	if err != nil {
+		return nil, err
+	}
+	for prefix, kind := range cloudIPDestinationPrefixes {
+		if strings.HasPrefix(id, prefix) {
+			return &cloudIPDestination{Id: id, Kind: kind}, nil
+		}
+	}
+	return nil, fmt.Errorf("Unknown Cloud IP destination '%s'", handle)
+}
+
+func (c *Client) cloudIPDestinationHandles() ([]resourceHandle, error) {
+	var handles []resourceHandle
+	for _, list := range []func() ([]resourceHandle, error){
+		c.serverHandles,
+		c.loadBalancerHandles,
+		c.databaseServerHandles,
+		c.serverGroupHandles,
+	} {
+		h, err := list()
+		if err != nil {
+			return nil, err
+		}
+		handles = append(handles, h...)
+	}
+	return handles, nil
+}
@@ -4,7 +4,7 @@ import (
 	"fmt"
 	"github.com/brightbox/gobrightbox"
 	"gopkg.in/alecthomas/kingpin.v2"
-	"os"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -16,20 +16,15 @@ var (
 
 type cloudIPsCommand struct {
 	*CLIApp
-	All          bool
-	Id           string
-	DestId       string
-	IdList       []string
-	ImageId      string
-	Name         string
-	CloudIPType  string
-	Zone         string
-	Groups       string
-	UserData     string
-	UserDataFile *os.File
-	Base64       bool
-	Fields       string
-	Unmap        bool
+	Id              string
+	DestId          string
+	IdList          []string
+	Name            *string
+	ReverseDns      *string
+	PortTranslators *string
+	Fields          string
+	Unmap           bool
+	Timeout         time.Duration
 }
 
 func cloudIPDestinationId(cip *brightbox.CloudIP) string {
@@ -41,7 +36,7 @@ func cloudIPDestinationId(cip *brightbox.CloudIP) string {
 	}
 
 	if cip.ServerGroup != nil {
-		return cip.Server.Id
+		return cip.ServerGroup.Id
 	}
 	if cip.DatabaseServer != nil {
 		return cip.DatabaseServer.Id
@@ -60,6 +55,52 @@ func formatPortTranslators(pts []brightbox.PortTranslator) string {
 	return strings.Join(fpts, ",")
 }
 
+// updateCloudIP updates a Cloud IP as UpdateCloudIP does, except that an
+// empty rather than nil list of port translators removes them all.
+// UpdateCloudIP leaves them alone, as it omits empty lists from the request.
+func (c *Client) updateCloudIP(opts *brightbox.CloudIPOptions) (*brightbox.CloudIP, error) {
+	if opts.PortTranslators == nil || len(opts.PortTranslators) > 0 {
+		return c.UpdateCloudIP(opts)
+	}
+	body := map[string]interface{}{"port_translators": opts.PortTranslators}
+	if opts.Name != nil {
+		body["name"] = *opts.Name
+	}
+	if opts.ReverseDns != nil {
+		body["reverse_dns"] = *opts.ReverseDns
+	}
+	cip := new(brightbox.CloudIP)
+	if _, err := c.MakeApiRequest("PUT", "/1.0/cloud_ips/"+opts.Id, body, cip); err != nil {
+		return nil, err
+	}
+	return cip, nil
+}
+
+// parsePortTranslators parses port translators in the in:out:protocol format
+// displayed by formatPortTranslators. An empty string is an empty list.
+func parsePortTranslators(s string) ([]brightbox.PortTranslator, error) {
+	pts := []brightbox.PortTranslator{}
+	for _, spt := range strings.Split(s, ",") {
+		if spt == "" {
+			continue
+		}
+		toks := strings.Split(spt, ":")
+		if len(toks) != 3 {
+			return nil, fmt.Errorf("Invalid port translator '%s', expected in:out:protocol", spt)
+		}
+		in, err := strconv.Atoi(toks[0])
+		if err != nil {
+			return nil, fmt.Errorf("Invalid incoming port in port translator '%s'", spt)
+		}
+		out, err := strconv.Atoi(toks[1])
+		if err != nil {
+			return nil, fmt.Errorf("Invalid outgoing port in port translator '%s'", spt)
+		}
+		pts = append(pts, brightbox.PortTranslator{Incoming: in, Outgoing: out, Protocol: toks[2]})
+	}
+	return pts, nil
+}
+
 func cloudIPFields(cip *brightbox.CloudIP) map[string]string {
 	return map[string]string{
 		"id":               cip.Id,
@@ -79,22 +120,21 @@ func (l *cloudIPsCommand) list(pc *kingpin.ParseContext) error {
 	if err != nil {
 		return err
 	}
-
-	out := new(RowFieldOutput)
-	out.Setup(strings.Split(l.Fields, ","))
-	out.SendHeader()
+	out, err := l.rowOutput(l.Fields)
+	if err != nil {
+		return err
+	}
 
 	cips, err := l.Client.CloudIPs()
 	if err != nil {
 		return err
 	}
 	for _, cip := range cips {
-		if err = out.Write(cloudIPFields(&cip)); err != nil {
+		if err = out.Write(cloudIPFields(&cip), cip); err != nil {
 			return err
 		}
 	}
-	out.Flush()
-	return nil
+	return out.Flush()
 }
 
 func (l *cloudIPsCommand) show(pc *kingpin.ParseContext) error {
@@ -102,19 +142,85 @@ func (l *cloudIPsCommand) show(pc *kingpin.ParseContext) error {
 	if err != nil {
 		return err
 	}
-	out := new(ShowFieldOutput)
-	out.Setup(strings.Split(l.Fields, ","))
-
+	l.Id, err = l.Client.cloudIPResolver().resolve(l.Id)
+	if err != nil {
+		return err
+	}
+	out, err := l.showOutput(l.Fields)
+	if err != nil {
+		return err
+	}
 	cip, err := l.Client.CloudIP(l.Id)
 	if err != nil {
 		l.Fatalf(err.Error())
 	}
-	if err = out.Write(cloudIPFields(cip)); err != nil {
+	if err = out.Write(cloudIPFields(cip), cip); err != nil {
 		return err
 	}
-	out.Flush()
-	return nil
+	return out.Flush()
+
+}
+
+func (l *cloudIPsCommand) create(pc *kingpin.ParseContext) error {
+	err := l.Configure()
+	if err != nil {
+		return err
+	}
+	out, err := l.showOutput(l.Fields)
+	if err != nil {
+		return err
+	}
+	newCloudIP := brightbox.CloudIPOptions{
+		Name: l.Name,
+	}
+	if l.PortTranslators != nil {
+		newCloudIP.PortTranslators, err = parsePortTranslators(*l.PortTranslators)
+		if err != nil {
+			return err
+		}
+	}
+	cip, err := l.Client.CreateCloudIP(&newCloudIP)
+	if err != nil {
+		return err
+	}
+	if err = out.Write(cloudIPFields(cip), cip); err != nil {
+		return err
+	}
+	return out.Flush()
+}
 
+func (l *cloudIPsCommand) update(pc *kingpin.ParseContext) error {
+	err := l.Configure()
+	if err != nil {
+		return err
+	}
+	l.Id, err = l.Client.cloudIPResolver().resolve(l.Id)
+	if err != nil {
+		return err
+	}
+	out, err := l.showOutput(l.Fields)
+	if err != nil {
+		return err
+	}
+	updateCloudIP := brightbox.CloudIPOptions{
+		Id:         l.Id,
+		Name:       l.Name,
+		ReverseDns: l.ReverseDns,
+	}
+	if l.PortTranslators != nil {
+		updateCloudIP.PortTranslators, err = parsePortTranslators(*l.PortTranslators)
+		if err != nil {
+			return err
+		}
+	}
+	cip, err := l.Client.updateCloudIP(&updateCloudIP)
+	if err != nil {
+		return err
+	}
+	if err = out.Write(cloudIPFields(cip), cip); err != nil {
+		return err
+	}
+	return out.Flush()
 }
 
 func (l *cloudIPsCommand) destroy(pc *kingpin.ParseContext) error {
@@ -122,6 +228,10 @@ func (l *cloudIPsCommand) destroy(pc *kingpin.ParseContext) error {
 	if err != nil {
 		return err
 	}
+	l.IdList, err = l.Client.cloudIPResolver().resolveAll(l.IdList)
+	if err != nil {
+		return err
+	}
 	for _, id := range l.IdList {
 		fmt.Printf("Destroying Cloud IP %s\n", id)
 		err := l.Client.DestroyCloudIP(id)
@@ -137,6 +247,14 @@ func (l *cloudIPsCommand) mapcip(pc *kingpin.ParseContext) error {
 	if err != nil {
 		return err
 	}
+	l.Id, err = l.Client.cloudIPResolver().resolve(l.Id)
+	if err != nil {
+		return err
+	}
+	dest, err := l.Client.resolveCloudIPDestination(l.DestId)
+	if err != nil {
+		return err
+	}
 	cip, err := l.Client.CloudIP(l.Id)
 	if err != nil {
 		l.Fatalf(err.Error())
@@ -147,25 +265,19 @@ func (l *cloudIPsCommand) mapcip(pc *kingpin.ParseContext) error {
 		if err != nil {
 			l.Fatalf(err.Error())
 		}
-		for i := 2; i <= 6; i++ {
-			cip, err = l.Client.CloudIP(l.Id)
-			if err != nil {
-				l.Fatalf(err.Error())
-			}
-			if cip.Status != "unmapped" {
-				fmt.Printf("Cloud IP %s not yet unmapped, waiting longer %d more seconds.\n", cip.Id, i)
-				time.Sleep(time.Duration(i) * time.Second)
-				continue
-			}
-		}
-		if cip.Status != "unmapped" {
-			l.Fatalf("Cloud IP %s wouldn't unmap, giving up.\n", cip.Id)
+		err = waitForStatus("Cloud IP "+cip.Id, l.Timeout, l.Client.cloudIPStatus(cip.Id), "unmapped")
+		if err != nil {
+			l.Fatalf(err.Error())
 		}
 	}
-	fmt.Printf("Mapping Cloud IP %s to destination %s\n", cip.Id, l.DestId)
-	err = l.Client.MapCloudIPtoServer(cip.Id, l.DestId)
+	fmt.Printf("Mapping Cloud IP %s to %s %s\n", cip.Id, dest.Kind, dest.Id)
+	if dest.Kind == "server" {
+		err = l.Client.MapCloudIPtoServer(cip.Id, dest.Id)
+	} else {
+		err = l.Client.MapCloudIP(cip.Id, dest.Id)
+	}
 	if err != nil {
-		l.Fatalf("%s: %s to %s", err.Error(), cip.Id, l.DestId)
+		l.Fatalf("%s: %s to %s", err.Error(), cip.Id, dest.Id)
 	}
 	return nil
 }
@@ -175,6 +287,10 @@ func (l *cloudIPsCommand) unmapcip(pc *kingpin.ParseContext) error {
 	if err != nil {
 		return err
 	}
+	l.Id, err = l.Client.cloudIPResolver().resolve(l.Id)
+	if err != nil {
+		return err
+	}
 	fmt.Printf("Unmapping Cloud IP %s\n", l.Id)
 	err = l.Client.UnMapCloudIP(l.Id)
 	if err != nil {
@@ -188,6 +304,7 @@ func configureCloudIPsCommand(app *CLIApp) {
 	cloudips := app.Command("cloudips", "Manage Cloud IPs")
 
 	list := cloudips.Command("list", "List Cloud IPs").Action(cmd.list).Default()
+	app.listFlags(list)
 	list.Flag("fields", "Which fields to display").
 		Default(strings.Join(defaultCloudIPListFields, ",")).
 		StringVar(&cmd.Fields)
@@ -196,20 +313,44 @@ func configureCloudIPsCommand(app *CLIApp) {
 	show.Flag("fields", "Which fields to display").
 		Default(strings.Join(defaultCloudIPShowFields, ",")).
 		StringVar(&cmd.Fields)
-	show.Arg("identifier", "Identifier of Cloud IP to show").Required().StringVar(&cmd.Id)
+	show.Arg("identifier", "Identifier or name of Cloud IP to show").Required().StringVar(&cmd.Id)
+
+	create := cloudips.Command("create", "Allocate a new Cloud IP").Action(cmd.create)
+	create.Flag("fields", "Which fields to display").
+		Default(strings.Join(defaultCloudIPShowFields, ",")).
+		StringVar(&cmd.Fields)
+	create.Flag("name", "Name to give the new Cloud IP").
+		Short('n').SetValue(&pStringValue{&cmd.Name})
+	create.Flag("port-translators", "Port translators in the format in:out:protocol. Comma separate multiple translators.").
+		Short('t').PlaceHolder("80:8080:tcp").SetValue(&pStringValue{&cmd.PortTranslators})
+
+	update := cloudips.Command("update", "Update a Cloud IP").Action(cmd.update)
+	update.Arg("identifier", "Identifier or name of Cloud IP to update").Required().StringVar(&cmd.Id)
+	update.Flag("fields", "Which fields to display").
+		Default(strings.Join(defaultCloudIPShowFields, ",")).
+		StringVar(&cmd.Fields)
+	update.Flag("name", "Set a new name for the Cloud IP").
+		Short('n').SetValue(&pStringValue{&cmd.Name})
+	update.Flag("reverse-dns", "Set the reverse DNS name of the Cloud IP").
+		Short('r').SetValue(&pStringValue{&cmd.ReverseDns})
+	update.Flag("port-translators", "Replace the port translators, in the format in:out:protocol. Comma separate multiple translators, or give '' to remove them all.").
+		Short('t').PlaceHolder("80:8080:tcp").SetValue(&pStringValue{&cmd.PortTranslators})
 
 	destroy := cloudips.Command("destroy", "Destroy a Cloud IP").Action(cmd.destroy)
-	destroy.Arg("identifier", "Identifier of Cloud IP to destroy").Required().StringsVar(&cmd.IdList)
+	destroy.Arg("identifier", "Identifier or name of Cloud IP to destroy").Required().StringsVar(&cmd.IdList)
 
 	mapcip := cloudips.Command("map", "Map a Cloud IP to another resource").Action(cmd.mapcip)
-	mapcip.Arg("cloud-ip", "Identifier of the Cloud IP").Required().StringVar(&cmd.Id)
-	mapcip.Arg("destination", "Identifier of the resource to which to map the Cloud IP").Required().StringVar(&cmd.DestId)
+	mapcip.Arg("cloud-ip", "Identifier or name of the Cloud IP").Required().StringVar(&cmd.Id)
+	mapcip.Arg("destination", "Identifier or name of the server, interface, load balancer, database server or server group to which to map the Cloud IP").Required().StringVar(&cmd.DestId)
 
 	mapcip.Flag("unmap", "Unmap any mapped Cloud IPs before remapping them").
 		Default("false").
 		BoolVar(&cmd.Unmap)
+	mapcip.Flag("timeout", "How long to wait for the Cloud IP to unmap before giving up").
+		Default("30s").
+		DurationVar(&cmd.Timeout)
 
 	unmapcip := cloudips.Command("unmap", "Unmap a mapped Cloud IP").Action(cmd.unmapcip)
-	unmapcip.Arg("cloud-ip", "Identifier of the Cloud IP").Required().StringVar(&cmd.Id)
+	unmapcip.Arg("cloud-ip", "Identifier or name of the Cloud IP").Required().StringVar(&cmd.Id)
 
 }
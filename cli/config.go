@@ -6,6 +6,7 @@ import (
 	"gopkg.in/alecthomas/kingpin.v2"
 	"gopkg.in/ini.v1"
 	"os"
+	"strings"
 )
 
 var (
@@ -160,6 +161,12 @@ func (c *config) setClient(clientName string) error {
 	}
 }
 
+var (
+	defaultConfigClientListFields = []string{"name", "clientid", "secret", "api_url", "auth_url"}
+	defaultConfigClientShowFields = []string{"name", "default", "client_id", "api_url", "auth_url",
+		"username", "secret", "default_account"}
+)
+
 type configCommand struct {
 	*CLIApp
 	Id      string
@@ -167,6 +174,26 @@ type configCommand struct {
 	ApiUrl  string
 	AuthUrl string
 	Name    string
+	Fields  string
+}
+
+func configClientFields(c *Client, isDefault bool) map[string]string {
+	name := c.ClientName
+	if isDefault {
+		name = "*" + name
+	}
+	return map[string]string{
+		"name":            name,
+		"client_name":     c.ClientName,
+		"default":         formatBool(isDefault),
+		"clientid":        c.ClientID,
+		"client_id":       c.ClientID,
+		"secret":          c.Secret,
+		"api_url":         c.ApiUrl,
+		"auth_url":        c.findAuthUrl(),
+		"username":        c.Username,
+		"default_account": c.DefaultAccount,
+	}
 }
 
 func (l *configCommand) list(pc *kingpin.ParseContext) error {
@@ -174,19 +201,18 @@ func (l *configCommand) list(pc *kingpin.ParseContext) error {
 	if err != nil {
 		return err
 	}
-	w := tabWriter()
-	defer w.Flush()
-	listRec(w, "NAME", "CLIENTID", "SECRET", "API_URL", "AUTH_URL")
+	out, err := l.rowOutput(l.Fields)
+	if err != nil {
+		return err
+	}
 	dc := cfg.DefaultClient()
 	for _, c := range cfg.clients {
-		name := c.ClientName
-		if dc != nil && dc.ClientName == name {
-			name = "*" + name
+		isDefault := dc != nil && dc.ClientName == c.ClientName
+		if err = out.Write(configClientFields(&c, isDefault), nil); err != nil {
+			return err
 		}
-		listRec(w, name, c.ClientID, c.Secret,
-			c.ApiUrl, c.findAuthUrl())
 	}
-	return nil
+	return out.Flush()
 }
 
 func (l *configCommand) add(pc *kingpin.ParseContext) error {
@@ -241,24 +267,23 @@ func (l *configCommand) show(pc *kingpin.ParseContext) error {
 	if err != nil {
 		return err
 	}
-	w := tabWriterRight()
-	defer w.Flush()
+	out, err := l.showOutput(l.Fields)
+	if err != nil {
+		return err
+	}
 	c, err := cfg.Client(l.Id)
 	if err != nil {
 		return err
 	}
 	dc := cfg.DefaultClient()
-	drawShow(w, []interface{}{
-		"name", c.ClientName,
-		"default", dc != nil && dc.ClientName == c.ClientName,
-		"client_id", c.ClientID,
-		"api_url", c.ApiUrl,
-		"auth_url", c.AuthUrl,
-		"username", c.Username,
-		"secret", c.Secret,
-		"default_account", c.DefaultAccount,
-	})
-	return nil
+	fields := configClientFields(c, dc != nil && dc.ClientName == c.ClientName)
+	// show the name without the default marker, and the auth url as configured
+	fields["name"] = c.ClientName
+	fields["auth_url"] = c.AuthUrl
+	if err = out.Write(fields, nil); err != nil {
+		return err
+	}
+	return out.Flush()
 
 }
 
@@ -267,11 +292,18 @@ func configureConfigCommand(app *CLIApp) {
 	cmd := app.Command("config", "manage cli configuration")
 	clients := cmd.Command("clients", "manage clients in local config")
 
-	clients.Command("list", "list local client configurations").
+	list := clients.Command("list", "list local client configurations").
 		Default().Action(c.list)
+	app.listFlags(list)
+	list.Flag("fields", "Which fields to display").
+		Default(strings.Join(defaultConfigClientListFields, ",")).
+		StringVar(&c.Fields)
 
 	show := clients.Command("show", "view details on a client config").Action(c.show)
 	show.Arg("name", "name or id of client config").Required().StringVar(&c.Id)
+	show.Flag("fields", "Which fields to display").
+		Default(strings.Join(defaultConfigClientShowFields, ",")).
+		StringVar(&c.Fields)
 
 	cadd := clients.Command("add", "Add new API client details to the local config").
 		Action(c.add)
@@ -0,0 +1,59 @@
+package cli
+
+import (
+	"github.com/brightbox/gobrightbox"
+	"gopkg.in/alecthomas/kingpin.v2"
+	"strings"
+)
+
+var (
+	defaultDatabaseServerTypeListFields = []string{"id", "ram", "disk", "name"}
+)
+
+type databaseServerTypesCommand struct {
+	*CLIApp
+	Fields string
+}
+
+func databaseServerTypeFields(t *brightbox.DatabaseServerType) map[string]string {
+	return map[string]string{
+		"id":          t.Id,
+		"name":        t.Name,
+		"description": t.Description,
+		"ram":         formatInt(t.RAM),
+		"disk":        formatInt(t.DiskSize),
+	}
+}
+
+func (l *databaseServerTypesCommand) list(pc *kingpin.ParseContext) error {
+	err := l.Configure()
+	if err != nil {
+		return err
+	}
+	out, err := l.rowOutput(l.Fields)
+	if err != nil {
+		return err
+	}
+	types, err := l.Client.DatabaseServerTypes()
+	if err != nil {
+		return err
+	}
+	for _, t := range types {
+		if err = out.Write(databaseServerTypeFields(&t), t); err != nil {
+			return err
+		}
+	}
+	return out.Flush()
+}
+
+func configureDatabaseServerTypesCommand(app *CLIApp, parent *kingpin.CmdClause) {
+	cmd := databaseServerTypesCommand{CLIApp: app}
+	types := parent.Command("types", "View database server types")
+
+	list := types.Command("list", "List database server types").
+		Default().Action(cmd.list)
+	app.listFlags(list)
+	list.Flag("fields", "Which fields to display").
+		Default(strings.Join(defaultDatabaseServerTypeListFields, ",")).
+		StringVar(&cmd.Fields)
+}
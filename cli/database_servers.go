@@ -0,0 +1,392 @@
+package cli
+
+import (
+	"fmt"
+	"github.com/brightbox/gobrightbox"
+	"gopkg.in/alecthomas/kingpin.v2"
+	"os"
+	"strings"
+)
+
+var (
+	defaultDatabaseServerListFields = []string{"id", "status", "type", "zone", "created", "engine", "version", "name"}
+	defaultDatabaseServerShowFields = []string{"id", "status", "locked", "name", "description", "created_at",
+		"deleted_at", "zone", "type", "type_name", "ram", "disk", "engine", "version", "admin_username",
+		"allow_access", "maintenance_weekday", "maintenance_hour", "snapshots_schedule", "cloud_ips"}
+	defaultDatabaseServerPasswordFields = []string{"id", "status", "name", "engine", "version",
+		"admin_username", "admin_password"}
+)
+
+type databaseServersCommand struct {
+	*CLIApp
+	Id                 string
+	IdList             []string
+	Name               *string
+	Description        *string
+	Engine             string
+	Version            string
+	ServerType         string
+	Zone               string
+	Snapshot           string
+	AllowAccess        *string
+	MaintenanceWeekday *int
+	MaintenanceHour    *int
+	SnapshotsSchedule  *string
+	PasswordFile       string
+	Fields             string
+}
+
+func databaseServerFields(s *brightbox.DatabaseServer) map[string]string {
+	return map[string]string{
+		"id":                  s.Id,
+		"status":              s.Status,
+		"locked":              formatBool(s.Locked),
+		"name":                s.Name,
+		"description":         s.Description,
+		"created":             s.CreatedAt.Format("2006-01-02"),
+		"created_at":          formatTime(s.CreatedAt),
+		"deleted_at":          formatTime(s.DeletedAt),
+		"zone":                s.Zone.Handle,
+		"zone_id":             s.Zone.Id,
+		"type":                s.DatabaseServerType.Id,
+		"type_name":           s.DatabaseServerType.Name,
+		"ram":                 formatInt(s.DatabaseServerType.RAM),
+		"disk":                formatInt(s.DatabaseServerType.DiskSize),
+		"engine":              s.DatabaseEngine,
+		"version":             s.DatabaseVersion,
+		"admin_username":      s.AdminUsername,
+		"admin_password":      s.AdminPassword,
+		"allow_access":        strings.Join(s.AllowAccess, ","),
+		"maintenance_weekday": formatInt(s.MaintenanceWeekday),
+		"maintenance_hour":    formatInt(s.MaintenanceHour),
+		"snapshots_schedule":  s.SnapshotsSchedule,
+		"cloud_ips":           collectById(s.CloudIPs),
+		"public_ips":          collectByField(s.CloudIPs, "PublicIP"),
+	}
+}
+
+// The admin password is only ever returned by the API when creating a
+// server or resetting its password, so it has to be shown there and then. If
+// a password file was given, write it there (readable only by the user)
+// rather than to the terminal.
+func (l *databaseServersCommand) showWithPassword(out *ShowFieldOutput, s *brightbox.DatabaseServer) error {
+	if l.PasswordFile != "" && s.AdminPassword != "" {
+		err := writePasswordFile(l.PasswordFile, s.AdminPassword)
+		if err != nil {
+			return err
+		}
+		s.AdminPassword = "(written to " + l.PasswordFile + ")"
+	}
+	if err := out.Write(databaseServerFields(s), s); err != nil {
+		return err
+	}
+	if err := out.Flush(); err != nil {
+		return err
+	}
+	if l.PasswordFile == "" && s.AdminPassword != "" {
+		fmt.Fprintln(os.Stderr, "The admin password cannot be retrieved again, make a note of it now.")
+	}
+	return nil
+}
+
+// writePasswordFile writes a password to a file readable only by the user.
+// An existing file keeps its permissions when truncated, so they're set
+// before the password is written.
+func writePasswordFile(filename, password string) error {
+	f, err := os.OpenFile(filename, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if err = f.Chmod(0600); err != nil {
+		f.Close()
+		return err
+	}
+	if _, err = f.WriteString(password + "\n"); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (l *databaseServersCommand) list(pc *kingpin.ParseContext) error {
+	err := l.Configure()
+	if err != nil {
+		return err
+	}
+	out, err := l.rowOutput(l.Fields)
+	if err != nil {
+		return err
+	}
+	servers, err := l.Client.DatabaseServers()
+	if err != nil {
+		return err
+	}
+	for _, s := range servers {
+		if err = out.Write(databaseServerFields(&s), s); err != nil {
+			return err
+		}
+	}
+	return out.Flush()
+}
+
+func (l *databaseServersCommand) show(pc *kingpin.ParseContext) error {
+	err := l.Configure()
+	if err != nil {
+		return err
+	}
+	l.Id, err = l.Client.databaseServerResolver().resolve(l.Id)
+	if err != nil {
+		return err
+	}
+	out, err := l.showOutput(l.Fields)
+	if err != nil {
+		return err
+	}
+	s, err := l.Client.DatabaseServer(l.Id)
+	if err != nil {
+		l.Fatalf(err.Error())
+	}
+	if err = out.Write(databaseServerFields(s), s); err != nil {
+		return err
+	}
+	return out.Flush()
+}
+
+func (l *databaseServersCommand) create(pc *kingpin.ParseContext) error {
+	err := l.Configure()
+	if err != nil {
+		return err
+	}
+	out, err := l.showOutput(l.Fields)
+	if err != nil {
+		return err
+	}
+	newServer := brightbox.DatabaseServerOptions{
+		Name:               l.Name,
+		Description:        l.Description,
+		Engine:             l.Engine,
+		Version:            l.Version,
+		DatabaseType:       l.ServerType,
+		Snapshot:           l.Snapshot,
+		MaintenanceWeekday: l.MaintenanceWeekday,
+		MaintenanceHour:    l.MaintenanceHour,
+		SnapshotsSchedule:  l.SnapshotsSchedule,
+	}
+	if l.Zone != "" {
+		zoneID, err := l.Client.resolveZoneId(l.Zone)
+		if err != nil {
+			return err
+		}
+		newServer.Zone = zoneID
+	}
+	if l.AllowAccess != nil {
+		newServer.AllowAccess = strings.Split(*l.AllowAccess, ",")
+	}
+
+	server, err := l.Client.CreateDatabaseServer(&newServer)
+	if err != nil {
+		return err
+	}
+	return l.showWithPassword(out, server)
+}
+
+func (l *databaseServersCommand) update(pc *kingpin.ParseContext) error {
+	err := l.Configure()
+	if err != nil {
+		return err
+	}
+	l.Id, err = l.Client.databaseServerResolver().resolve(l.Id)
+	if err != nil {
+		return err
+	}
+	out, err := l.showOutput(l.Fields)
+	if err != nil {
+		return err
+	}
+	updateServer := brightbox.DatabaseServerOptions{
+		Id:                 l.Id,
+		Name:               l.Name,
+		Description:        l.Description,
+		MaintenanceWeekday: l.MaintenanceWeekday,
+		MaintenanceHour:    l.MaintenanceHour,
+		SnapshotsSchedule:  l.SnapshotsSchedule,
+	}
+	if l.AllowAccess != nil {
+		updateServer.AllowAccess = strings.Split(*l.AllowAccess, ",")
+	}
+
+	server, err := l.Client.UpdateDatabaseServer(&updateServer)
+	if err != nil {
+		return err
+	}
+	if err = out.Write(databaseServerFields(server), server); err != nil {
+		return err
+	}
+	return out.Flush()
+}
+
+func (l *databaseServersCommand) destroy(pc *kingpin.ParseContext) error {
+	err := l.Configure()
+	if err != nil {
+		return err
+	}
+	l.IdList, err = l.Client.databaseServerResolver().resolveAll(l.IdList)
+	if err != nil {
+		return err
+	}
+	returnError := false
+	for _, id := range l.IdList {
+		fmt.Printf("Destroying database server %s\n", id)
+		err := l.Client.DestroyDatabaseServer(id)
+		if err != nil {
+			l.Errorf("%s: %s", err.Error(), id)
+			returnError = true
+		}
+	}
+	if returnError {
+		return errGeneric
+	}
+	return nil
+}
+
+func (l *databaseServersCommand) resetPassword(pc *kingpin.ParseContext) error {
+	err := l.Configure()
+	if err != nil {
+		return err
+	}
+	l.Id, err = l.Client.databaseServerResolver().resolve(l.Id)
+	if err != nil {
+		return err
+	}
+	out, err := l.showOutput(l.Fields)
+	if err != nil {
+		return err
+	}
+	server, err := l.Client.ResetPasswordForDatabaseServer(l.Id)
+	if err != nil {
+		return err
+	}
+	return l.showWithPassword(out, server)
+}
+
+func (l *databaseServersCommand) snapshot(pc *kingpin.ParseContext) error {
+	err := l.Configure()
+	if err != nil {
+		return err
+	}
+	l.IdList, err = l.Client.databaseServerResolver().resolveAll(l.IdList)
+	if err != nil {
+		return err
+	}
+	returnError := false
+	for _, id := range l.IdList {
+		fmt.Printf("Snapshotting database server %s\n", id)
+		snap, err := l.Client.SnapshotDatabaseServer(id)
+		if err != nil {
+			if len(l.IdList) == 1 {
+				return err
+			}
+			l.Errorf("%s: %s", err.Error(), id)
+			returnError = true
+			continue
+		}
+		fmt.Printf("Database snapshot %s started from database server %s\n", snap.Id, id)
+	}
+	if returnError {
+		return errGeneric
+	}
+	return nil
+}
+
+// Both create and update take the same set of settings flags
+func (l *databaseServersCommand) settingsFlags(cmd *kingpin.CmdClause) {
+	cmd.Flag("description", "Description of the database server").
+		Short('d').SetValue(&pStringValue{&l.Description})
+	cmd.Flag("allow-access", "Identifiers or IP addresses allowed to access the database server. Comma separate multiple entries.").
+		SetValue(&pStringValue{&l.AllowAccess})
+	cmd.Flag("maintenance-weekday", "Day of the week for maintenance, 0 is Sunday").
+		SetValue(&pIntValue{&l.MaintenanceWeekday})
+	cmd.Flag("maintenance-hour", "Hour of the day (UTC) for maintenance").
+		SetValue(&pIntValue{&l.MaintenanceHour})
+	cmd.Flag("snapshots-schedule", "Crontab pattern for scheduled snapshots").
+		SetValue(&pStringValue{&l.SnapshotsSchedule})
+}
+
+func configureSqlCommand(app *CLIApp) {
+	sql := app.Command("sql", "Manage Cloud SQL database servers")
+	configureDatabaseServersCommand(app, sql)
+	configureDatabaseSnapshotsCommand(app, sql)
+	configureDatabaseServerTypesCommand(app, sql)
+}
+
+func configureDatabaseServersCommand(app *CLIApp, parent *kingpin.CmdClause) {
+	cmd := databaseServersCommand{CLIApp: app}
+	servers := parent.Command("servers", "Manage database servers")
+
+	list := servers.Command("list", "List database servers").
+		Default().Action(cmd.list)
+	app.listFlags(list)
+	list.Flag("fields", "Which fields to display").
+		Default(strings.Join(defaultDatabaseServerListFields, ",")).
+		StringVar(&cmd.Fields)
+
+	show := servers.Command("show", "View details of a database server").
+		Action(cmd.show)
+	show.Arg("identifier", "Identifier or name of database server to show").
+		Required().StringVar(&cmd.Id)
+	show.Flag("fields", "Which fields to display").
+		Default(strings.Join(defaultDatabaseServerShowFields, ",")).
+		StringVar(&cmd.Fields)
+
+	create := servers.Command("create", "Create a new database server").
+		Action(cmd.create)
+	create.Flag("fields", "Which fields to display").
+		Default(strings.Join(defaultDatabaseServerPasswordFields, ",")).
+		StringVar(&cmd.Fields)
+	create.Flag("name", "Name to give the new database server").
+		Short('n').SetValue(&pStringValue{&cmd.Name})
+	create.Flag("engine", "Database engine, e.g: mysql").
+		Short('e').StringVar(&cmd.Engine)
+	create.Flag("engine-version", "Version of the database engine").
+		Short('v').StringVar(&cmd.Version)
+	create.Flag("type", "Identifier of database server type").
+		Short('t').StringVar(&cmd.ServerType)
+	create.Flag("zone", "Availability zone in which to place the new database server").
+		Short('z').StringVar(&cmd.Zone)
+	create.Flag("snapshot", "Identifier of database snapshot to create the server from").
+		StringVar(&cmd.Snapshot)
+	create.Flag("password-file", "Write the admin password to this file instead of displaying it").
+		PlaceHolder("FILENAME").StringVar(&cmd.PasswordFile)
+	cmd.settingsFlags(create)
+
+	update := servers.Command("update", "Update a database server").
+		Action(cmd.update)
+	update.Arg("identifier", "Identifier or name of database server to update").
+		Required().StringVar(&cmd.Id)
+	update.Flag("fields", "Which fields to display").
+		Default(strings.Join(defaultDatabaseServerShowFields, ",")).
+		StringVar(&cmd.Fields)
+	update.Flag("name", "Set a new name for the database server").
+		Short('n').SetValue(&pStringValue{&cmd.Name})
+	cmd.settingsFlags(update)
+
+	destroy := servers.Command("destroy", "Destroy a database server").
+		Action(cmd.destroy)
+	destroy.Arg("identifier", "Identifier or name of database servers to destroy").
+		Required().StringsVar(&cmd.IdList)
+
+	reset := servers.Command("reset_password", "Reset the admin password of a database server").
+		Action(cmd.resetPassword)
+	reset.Arg("identifier", "Identifier or name of database server to reset the password of").
+		Required().StringVar(&cmd.Id)
+	reset.Flag("fields", "Which fields to display").
+		Default(strings.Join(defaultDatabaseServerPasswordFields, ",")).
+		StringVar(&cmd.Fields)
+	reset.Flag("password-file", "Write the admin password to this file instead of displaying it").
+		PlaceHolder("FILENAME").StringVar(&cmd.PasswordFile)
+
+	snap := servers.Command("snapshot", "Snapshot a database server").
+		Action(cmd.snapshot)
+	snap.Arg("identifier", "Identifier or name of database servers to snapshot").
+		Required().StringsVar(&cmd.IdList)
+}
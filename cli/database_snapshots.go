@@ -0,0 +1,130 @@
+package cli
+
+import (
+	"fmt"
+	"github.com/brightbox/gobrightbox"
+	"gopkg.in/alecthomas/kingpin.v2"
+	"strings"
+)
+
+var (
+	defaultDatabaseSnapshotListFields = []string{"id", "status", "created", "size", "engine", "version", "name"}
+	defaultDatabaseSnapshotShowFields = []string{"id", "status", "locked", "name", "description", "created_at",
+		"deleted_at", "size", "engine", "version"}
+)
+
+type databaseSnapshotsCommand struct {
+	*CLIApp
+	Id     string
+	IdList []string
+	Fields string
+}
+
+func databaseSnapshotFields(s *brightbox.DatabaseSnapshot) map[string]string {
+	return map[string]string{
+		"id":          s.Id,
+		"status":      s.Status,
+		"locked":      formatBool(s.Locked),
+		"name":        s.Name,
+		"description": s.Description,
+		"created":     s.CreatedAt.Format("2006-01-02"),
+		"created_at":  formatTime(s.CreatedAt),
+		"deleted_at":  formatTime(s.DeletedAt),
+		"size":        formatInt(s.Size),
+		"engine":      s.DatabaseEngine,
+		"version":     s.DatabaseVersion,
+	}
+}
+
+func (l *databaseSnapshotsCommand) list(pc *kingpin.ParseContext) error {
+	err := l.Configure()
+	if err != nil {
+		return err
+	}
+	out, err := l.rowOutput(l.Fields)
+	if err != nil {
+		return err
+	}
+	snapshots, err := l.Client.DatabaseSnapshots()
+	if err != nil {
+		return err
+	}
+	for _, s := range snapshots {
+		if err = out.Write(databaseSnapshotFields(&s), s); err != nil {
+			return err
+		}
+	}
+	return out.Flush()
+}
+
+func (l *databaseSnapshotsCommand) show(pc *kingpin.ParseContext) error {
+	err := l.Configure()
+	if err != nil {
+		return err
+	}
+	l.Id, err = l.Client.databaseSnapshotResolver().resolve(l.Id)
+	if err != nil {
+		return err
+	}
+	out, err := l.showOutput(l.Fields)
+	if err != nil {
+		return err
+	}
+	s, err := l.Client.DatabaseSnapshot(l.Id)
+	if err != nil {
+		l.Fatalf(err.Error())
+	}
+	if err = out.Write(databaseSnapshotFields(s), s); err != nil {
+		return err
+	}
+	return out.Flush()
+}
+
+func (l *databaseSnapshotsCommand) destroy(pc *kingpin.ParseContext) error {
+	err := l.Configure()
+	if err != nil {
+		return err
+	}
+	l.IdList, err = l.Client.databaseSnapshotResolver().resolveAll(l.IdList)
+	if err != nil {
+		return err
+	}
+	returnError := false
+	for _, id := range l.IdList {
+		fmt.Printf("Destroying database snapshot %s\n", id)
+		err := l.Client.DestroyDatabaseSnapshot(id)
+		if err != nil {
+			l.Errorf("%s: %s", err.Error(), id)
+			returnError = true
+		}
+	}
+	if returnError {
+		return errGeneric
+	}
+	return nil
+}
+
+func configureDatabaseSnapshotsCommand(app *CLIApp, parent *kingpin.CmdClause) {
+	cmd := databaseSnapshotsCommand{CLIApp: app}
+	snapshots := parent.Command("snapshots", "Manage database snapshots")
+
+	list := snapshots.Command("list", "List database snapshots").
+		Default().Action(cmd.list)
+	app.listFlags(list)
+	list.Flag("fields", "Which fields to display").
+		Default(strings.Join(defaultDatabaseSnapshotListFields, ",")).
+		StringVar(&cmd.Fields)
+
+	show := snapshots.Command("show", "View details of a database snapshot").
+		Action(cmd.show)
+	show.Arg("identifier", "Identifier or name of database snapshot to show").
+		Required().StringVar(&cmd.Id)
+	show.Flag("fields", "Which fields to display").
+		Default(strings.Join(defaultDatabaseSnapshotShowFields, ",")).
+		StringVar(&cmd.Fields)
+
+	destroy := snapshots.Command("destroy", "Destroy a database snapshot").
+		Action(cmd.destroy)
+	destroy.Arg("identifier", "Identifier or name of database snapshots to destroy").
+		Required().StringsVar(&cmd.IdList)
+}
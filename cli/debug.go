@@ -0,0 +1,67 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// debugTransport is a transport that logs each request and response, with
+// their headers and bodies, and how long the response took. Credentials are
+// masked as they are in cassettes.
+type debugTransport struct {
+	Transport http.RoundTripper
+	Writer    io.Writer
+	mu        sync.Mutex
+}
+
+func (d *debugTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	reqBody, err := readBody(&req.Body)
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	res, err := d.Transport.RoundTrip(req)
+	latency := time.Since(start)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	fmt.Fprintf(d.Writer, "> %s %s\n", req.Method, req.URL)
+	d.writeHeaders(">", req.Header)
+	d.writeBody(">", req.Header.Get("Content-Type"), reqBody)
+	if err != nil {
+		fmt.Fprintf(d.Writer, "< %s after %s\n", err.Error(), latency)
+		return nil, err
+	}
+	resBody, err := readBody(&res.Body)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(d.Writer, "< %s in %s\n", res.Status, latency)
+	d.writeHeaders("<", res.Header)
+	d.writeBody("<", res.Header.Get("Content-Type"), resBody)
+	return res, nil
+}
+
+func (d *debugTransport) writeHeaders(prefix string, h http.Header) {
+	h = redactHeaders(h)
+	names := make([]string, 0, len(h))
+	for name := range h {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, v := range h[name] {
+			fmt.Fprintf(d.Writer, "%s %s: %s\n", prefix, name, v)
+		}
+	}
+}
+
+func (d *debugTransport) writeBody(prefix, contentType string, body []byte) {
+	if len(body) > 0 {
+		fmt.Fprintf(d.Writer, "%s %s\n", prefix, redactBody(contentType, body))
+	}
+}
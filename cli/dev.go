@@ -0,0 +1,28 @@
+package cli
+
+import (
+	"fmt"
+	"github.com/brightbox/gobrightbox-cli/fakeapi"
+	"gopkg.in/alecthomas/kingpin.v2"
+	"net/http"
+	"os"
+)
+
+type devCommand struct {
+	*CLIApp
+	Listen string
+}
+
+func (l *devCommand) fakeAPI(pc *kingpin.ParseContext) error {
+	fmt.Fprintf(os.Stderr, "Fake API for account %s listening on %s\n", fakeapi.AccountId, l.Listen)
+	return http.ListenAndServe(l.Listen, fakeapi.New())
+}
+
+func configureDevCommand(app *CLIApp) {
+	cmd := devCommand{CLIApp: app}
+	dev := app.Command("dev", "Tools for developing against the API")
+	fake := dev.Command("fake-api", "Serve an in-memory fake of the API, for offline use and tests. Any client credentials are accepted").
+		Action(cmd.fakeAPI)
+	fake.Flag("listen", "Address to listen on").
+		Default(":8080").StringVar(&cmd.Listen)
+}
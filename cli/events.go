@@ -1,23 +1,33 @@
 package cli
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"github.com/gorilla/websocket"
 	"gopkg.in/alecthomas/kingpin.v2"
-	"io"
 	"log"
-	"strings"
+	"os"
+	"time"
 )
 
 type eventsCommand struct {
 	*CLIApp
-	Id     string
-	Format string
+	Id              string
+	EventFilter     eventFilter
+	Exec            string
+	ExecConcurrency int
+	ExecTimeout     time.Duration
+	URL             string
+	Secret          string
+	QueueDir        string
+	RequeueFailed   bool
 }
 
 type fayeAdvice struct {
-	Timeout int
+	Reconnect string `json:"reconnect,omitempty"`
+	Interval  *int   `json:"interval,omitempty"`
+	Timeout   *int   `json:"timeout,omitempty"`
 }
 type fayeAuth struct {
 	AuthToken string `json:"auth_token"`
@@ -77,119 +87,142 @@ func recvmsg(ws *websocket.Conn) ([]fayeMsg, error) {
 	return msgl, nil
 }
 
-func (l *eventsCommand) watch(pc *kingpin.ParseContext) error {
-	err := l.Configure()
-	if err != nil {
-		return err
+// receivedEvent is an event, decoded from its payload, and when it was
+// received
+type receivedEvent struct {
+	event
+	Received time.Time
+	Payload  json.RawMessage
+}
+
+func decodeEvent(received time.Time, payload json.RawMessage) (*receivedEvent, error) {
+	e := &receivedEvent{Received: received, Payload: payload}
+	if err := json.Unmarshal(payload, &e.event); err != nil {
+		return nil, err
 	}
-	w := tabWriterRight()
-	defer w.Flush()
+	return e, nil
+}
 
-	token, err := l.Client.TokenSource().Token()
-	if err != nil {
-		return err
+// JSON is the event's full payload, with a received_at timestamp added
+func (e *receivedEvent) JSON() ([]byte, error) {
+	var fields map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(e.Payload))
+	dec.UseNumber()
+	if err := dec.Decode(&fields); err != nil {
+		return nil, err
 	}
+	fields["received_at"] = e.Received.UTC().Format(time.RFC3339Nano)
+	return json.Marshal(fields)
+}
 
-	handshake := fayeMsg{
-		Channel:                  "/meta/handshake",
-		Version:                  "1.0",
-		SupportedConnectionTypes: []string{"long-polling", "websocket"},
+// Text is a one line summary of the event, of who did what to which resource
+func (e *receivedEvent) Text() string {
+	var s string
+	if e.User.Email != nil {
+		s = fmt.Sprintf("<%s>", *e.User.Email)
+	}
+	if e.Client.Id != "" {
+		s += fmt.Sprintf(" client:%s", e.Client.Id)
+	}
+	if e.Action != "" {
+		s += fmt.Sprintf(" action:%s", e.Action)
+	}
+	if e.Resource.Id != "" {
+		s += fmt.Sprintf(" resource:%s", e.Resource.Id)
+	} else {
+		s += fmt.Sprintf(" event:%s", string(e.Payload))
+	}
+	if len(e.Affects) > 0 && (len(e.Affects) > 1 || e.Affects[0].Id != e.Resource.Id) {
+		s += fmt.Sprintf(" affects:%s", collectById(e.Affects))
+	}
+	if len(e.Touches) > 0 && (len(e.Touches) > 1 || e.Touches[0].Id != e.Resource.Id) {
+		s += fmt.Sprintf(" touches:%s", collectById(e.Touches))
 	}
+	return s
+}
 
-	url := "wss://events." + l.Client.findRegionDomain() + "/stream"
-	ws, _, err := websocket.DefaultDialer.Dial(url, nil)
-	if err != nil {
-		return err
+// output writes an event as one line of JSON to stdout with --format json,
+// or logs a summary of it otherwise
+func (l *eventsCommand) output(e *receivedEvent) {
+	if l.Format != "json" {
+		log.Println(e.Text())
+		return
 	}
-	defer ws.Close()
-	err = sendmsg(ws, &handshake)
+	data, err := e.JSON()
 	if err != nil {
-		return err
+		log.Println(err)
+		return
 	}
+	os.Stdout.Write(append(data, '\n'))
+}
 
-	msgl, err := recvmsg(ws)
+func (l *eventsCommand) watch(pc *kingpin.ParseContext) error {
+	if l.Format != "text" && l.Format != "json" {
+		return fmt.Errorf("Events can only be output in text or json format")
+	}
+	err := l.EventFilter.check()
 	if err != nil {
 		return err
 	}
-	msg := msgl[0]
-	cid := msg.ClientId
-
-	err = sendmsg(ws, nil)
-
-	connect := fayeMsg{
-		Channel:        "/meta/connect",
-		ClientId:       cid,
-		ConnectionType: "websocket",
-	}
-	subscribe := fayeMsg{
-		Channel:      "/meta/subscribe",
-		ClientId:     cid,
-		Subscription: "/account/" + l.accountId(),
-		Ext:          &fayeAuth{AuthToken: token.AccessToken},
-	}
-	err = sendmsg(ws, &connect, &subscribe)
+	if l.ExecConcurrency < 1 {
+		return fmt.Errorf("--exec-concurrency must be at least 1")
+	}
+	if l.ExecTimeout < time.Second {
+		return fmt.Errorf("--exec-timeout must be at least 1s")
+	}
+	err = l.Configure()
 	if err != nil {
 		return err
 	}
-	for {
-		msgl, err := recvmsg(ws)
-		if err == io.EOF {
-			log.Println("EOF Disconnected")
-			return nil
+	var hooks *eventHooks
+	if l.Exec != "" {
+		hooks = newEventHooks(l.Exec, l.ExecConcurrency, l.ExecTimeout)
+	}
+	return l.subscribe(func(e *receivedEvent) {
+		l.output(e)
+		if hooks != nil {
+			hooks.run(e)
 		}
+	})
+}
+
+// subscribe receives events until the stream is closed, passing those that
+// pass the filter to handle
+func (l *eventsCommand) subscribe(handle func(e *receivedEvent)) error {
+	stream := l.Client.eventStream(l.accountId(), func(received time.Time, payload json.RawMessage) {
+		e, err := decodeEvent(received, payload)
 		if err != nil {
-			return err
+			log.Println(err)
+			return
 		}
-		for _, msg := range msgl {
-			if msg.Data != nil && strings.HasPrefix(msg.Channel, "/account/acc") {
-				e := event{}
-				err = json.Unmarshal(*msg.Data, &e)
-				if err != nil {
-					log.Println(err)
-					continue
-				}
-				//log.Println(string(*msg.Data))
-				var s string
-				if e.User.Email != nil {
-					s = fmt.Sprintf("<%s>", *e.User.Email)
-				}
-				if e.Client.Id != "" {
-					s += fmt.Sprintf(" client:%s", e.Client.Id)
-				}
-				if e.Action != "" {
-					s += fmt.Sprintf(" action:%s", e.Action)
-				}
-				if e.Resource.Id != "" {
-					s += fmt.Sprintf(" resource:%s", e.Resource.Id)
-				} else {
-					s += fmt.Sprintf(" event:%s", string(*msg.Data))
-				}
-				if len(e.Affects) > 0 && (len(e.Affects) > 1 || e.Affects[0].Id != e.Resource.Id) {
-					s += fmt.Sprintf(" affects:%s", collectById(e.Affects))
-				}
-				if len(e.Touches) > 0 && (len(e.Touches) > 1 || e.Touches[0].Id != e.Resource.Id) {
-					s += fmt.Sprintf(" touches:%s", collectById(e.Touches))
-				}
-				log.Println(s)
-			}
-			if msg.Channel == "/meta/connect" {
-				if msg.Successful {
-					err = sendmsg(ws, &connect)
-					if err != nil {
-						log.Println("Connect error: ", err.Error())
-					}
-				} else {
-					return fmt.Errorf("Event connection failure: " + msg.Error)
-				}
-			} else if msg.Channel == "/meta/subscribe" && !msg.Successful {
-				return fmt.Errorf("Event subscription failure: " + msg.Error)
-			}
+		if l.EventFilter.Match(&e.event) {
+			handle(e)
 		}
-	}
+	})
+	return stream.run()
 }
 
 func configureEventsCommand(app *CLIApp) {
 	cmd := eventsCommand{CLIApp: app}
 	events := app.Command("events", "view event stream")
-	events.Command("watch", "listen for events and output them").Action(cmd.watch)
+	watch := events.Command("watch", "listen for events and output them, as text or, with --format json, as one JSON object per line").Action(cmd.watch)
+	cmd.EventFilter.eventFilterFlags(watch)
+	watch.Flag("exec", "Run a shell command for each event, with the event's JSON on stdin and its key fields in BRIGHTBOX_EVENT_* environment variables").
+		PlaceHolder("CMD").StringVar(&cmd.Exec)
+	watch.Flag("exec-concurrency", "How many --exec commands may run at once").
+		Default("4").IntVar(&cmd.ExecConcurrency)
+	watch.Flag("exec-timeout", "How long an --exec command may run, at least 1s, before it and anything it started are killed").
+		Default("1m").DurationVar(&cmd.ExecTimeout)
+
+	forward := events.Command("forward", "POST events as JSON to a webhook, signed with HMAC-SHA256 in the "+forwardSignatureHeader+" header. Events are queued on disk until delivered").
+		Action(cmd.forward)
+	forward.Flag("url", "URL of the webhook").
+		Required().StringVar(&cmd.URL)
+	forward.Flag("secret", "Secret to sign requests with. Defaults to $BRIGHTBOX_WEBHOOK_SECRET").
+		OverrideDefaultFromEnvar("BRIGHTBOX_WEBHOOK_SECRET").Required().StringVar(&cmd.Secret)
+	forward.Flag("queue", "Directory to queue events in until they are delivered. Defaults to one for the URL in the cache directory").
+		PlaceHolder("DIR").StringVar(&cmd.QueueDir)
+	forward.Flag("requeue-failed", "Move events the webhook rejected back into the queue, to be delivered again first").
+		BoolVar(&cmd.RequeueFailed)
+	cmd.EventFilter.eventFilterFlags(forward)
 }
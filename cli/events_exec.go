@@ -0,0 +1,120 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// eventHookQueue is how many events can wait for a hook to be free before
+// more are skipped
+const eventHookQueue = 100
+
+// eventHooks runs a shell command for each event, in the background so a
+// slow command can't hold up receiving events. At most concurrency commands
+// run at once, and each is killed if it takes longer than timeout.
+type eventHooks struct {
+	command string
+	timeout time.Duration
+	queue   chan *receivedEvent
+}
+
+func newEventHooks(command string, concurrency int, timeout time.Duration) *eventHooks {
+	h := &eventHooks{
+		command: command,
+		timeout: timeout,
+		queue:   make(chan *receivedEvent, eventHookQueue),
+	}
+	for i := 0; i < concurrency; i++ {
+		go h.work()
+	}
+	return h
+}
+
+// run queues an event for the hook, skipping it if the queue is full
+func (h *eventHooks) run(e *receivedEvent) {
+	select {
+	case h.queue <- e:
+	default:
+		log.Printf("Hook queue full, skipping event %s", e.Id)
+	}
+}
+
+func (h *eventHooks) work() {
+	for e := range h.queue {
+		if err := h.exec(e); err != nil {
+			log.Printf("Hook failed for event %s: %s", e.Id, err.Error())
+		}
+	}
+}
+
+// exec runs the hook's command with the event's JSON on stdin, and its key
+// fields in the environment. Its output goes to stderr. The command runs in
+// its own process group, so anything it starts is killed with it if it times
+// out.
+func (h *eventHooks) exec(e *receivedEvent) error {
+	data, err := e.JSON()
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command("sh", "-c", h.command)
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(), eventEnv(e)...)
+	setProcessGroup(cmd)
+	if err = cmd.Start(); err != nil {
+		return err
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+	timer := time.NewTimer(h.timeout)
+	defer timer.Stop()
+	select {
+	case err = <-done:
+		return err
+	case <-timer.C:
+		killProcessGroup(cmd)
+		<-done
+		return fmt.Errorf("timed out after %s", h.timeout)
+	}
+}
+
+// eventEnv is the event's key fields as BRIGHTBOX_EVENT_* environment
+// variables
+func eventEnv(e *receivedEvent) []string {
+	var email string
+	if e.User.Email != nil {
+		email = *e.User.Email
+	}
+	var resourceType string
+	if i := strings.Index(e.Resource.Id, "-"); i > 0 {
+		resourceType = e.Resource.Id[:i]
+	}
+	vars := map[string]string{
+		"ID":            e.Id,
+		"ACTION":        e.Action,
+		"STATE":         e.State,
+		"RESOURCE_ID":   e.Resource.Id,
+		"RESOURCE_NAME": e.Resource.Name,
+		"RESOURCE_TYPE": resourceType,
+		"ACCOUNT_ID":    e.Account.Id,
+		"USER_ID":       e.User.Id,
+		"USER_EMAIL":    email,
+		"CLIENT_ID":     e.Client.Id,
+		"AFFECTS":       collectById(e.Affects),
+		"TOUCHES":       collectById(e.Touches),
+		"RECEIVED_AT":   e.Received.UTC().Format(time.RFC3339Nano),
+	}
+	env := make([]string, 0, len(vars))
+	for k, v := range vars {
+		env = append(env, "BRIGHTBOX_EVENT_"+k+"="+v)
+	}
+	return env
+}
@@ -0,0 +1,72 @@
+//go:build !windows
+// +build !windows
+
+package cli
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEventHooksExec(t *testing.T) {
+	dir, err := ioutil.TempDir("", "brightbox-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	h := &eventHooks{command: "cat > " + dir + "/event.json; echo $BRIGHTBOX_EVENT_ACTION $BRIGHTBOX_EVENT_RESOURCE_TYPE $BRIGHTBOX_EVENT_AFFECTS > " + dir + "/env", timeout: 5 * time.Second}
+	if err := h.exec(testReceivedEvent(t)); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(dir + "/event.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatal(err)
+	}
+	if fields["id"] != "evt-aaaaa" || fields["received_at"] != "2026-01-02T03:04:05Z" {
+		t.Errorf("got event %s", data)
+	}
+	data, err = ioutil.ReadFile(dir + "/env")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.TrimSpace(string(data)), "map cip cip-web01,srv-web01"; got != want {
+		t.Errorf("got environment %q, want %q", got, want)
+	}
+
+	h.command = "exit 3"
+	if err := h.exec(testReceivedEvent(t)); err == nil || err.Error() != "exit status 3" {
+		t.Errorf("got error %v, want exit status 3", err)
+	}
+}
+
+func TestEventHooksExecTimeout(t *testing.T) {
+	dir, err := ioutil.TempDir("", "brightbox-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The background subshell must be killed along with the shell
+	h := &eventHooks{command: "(sleep 1; touch " + dir + "/late) & wait", timeout: 100 * time.Millisecond}
+	start := time.Now()
+	err = h.exec(testReceivedEvent(t))
+	if err == nil || err.Error() != "timed out after 100ms" {
+		t.Errorf("got error %v, want a timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 900*time.Millisecond {
+		t.Errorf("took %s to time out", elapsed)
+	}
+	time.Sleep(1500 * time.Millisecond)
+	if _, err := os.Stat(dir + "/late"); err == nil {
+		t.Error("the hook's background process wasn't killed")
+	}
+}
@@ -0,0 +1,20 @@
+//go:build !windows
+// +build !windows
+
+package cli
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup makes a command the leader of a new process group
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// killProcessGroup kills a started command and everything else in its
+// process group
+func killProcessGroup(cmd *exec.Cmd) {
+	syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
@@ -0,0 +1,18 @@
+//go:build windows
+// +build windows
+
+package cli
+
+import (
+	"os/exec"
+)
+
+// setProcessGroup does nothing on Windows, which has no process groups
+func setProcessGroup(cmd *exec.Cmd) {
+}
+
+// killProcessGroup kills a started command. Anything it started is left
+// running.
+func killProcessGroup(cmd *exec.Cmd) {
+	cmd.Process.Kill()
+}
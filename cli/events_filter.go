@@ -0,0 +1,104 @@
+package cli
+
+import (
+	"fmt"
+	"gopkg.in/alecthomas/kingpin.v2"
+	"path"
+	"strings"
+)
+
+// eventFilter selects which events to act on. Each kind of pattern that is
+// given must match, and matches if any one of its glob patterns does.
+type eventFilter struct {
+	Actions       []string
+	ResourceTypes []string
+	Resources     []string
+	Users         []string
+	Clients       []string
+}
+
+// eventFilterFlags adds the flags for filtering events to a command
+func (f *eventFilter) eventFilterFlags(cmd *kingpin.CmdClause) {
+	cmd.Flag("action", "Only events with an action matching this glob, e.g: 'destroy' or 'map*'. Give action:state to match the state too. Can be repeated.").
+		PlaceHolder("GLOB").StringsVar(&f.Actions)
+	cmd.Flag("resource-type", "Only events about resources with this identifier prefix, e.g: srv- or cip-. Can be repeated.").
+		PlaceHolder("PREFIX").StringsVar(&f.ResourceTypes)
+	cmd.Flag("resource", "Only events about resources with an identifier or name matching this glob. Can be repeated.").
+		PlaceHolder("GLOB").StringsVar(&f.Resources)
+	cmd.Flag("user", "Only events caused by users with an email address, identifier or name matching this glob. Can be repeated.").
+		PlaceHolder("GLOB").StringsVar(&f.Users)
+	cmd.Flag("api-client", "Only events caused by API clients with an identifier or name matching this glob. Can be repeated.").
+		PlaceHolder("GLOB").StringsVar(&f.Clients)
+}
+
+// check makes sure all the patterns are valid globs, and turns resource
+// types into patterns matching identifiers
+func (f *eventFilter) check() error {
+	for i, prefix := range f.ResourceTypes {
+		if !strings.HasSuffix(prefix, "*") {
+			f.ResourceTypes[i] = strings.TrimSuffix(prefix, "-") + "-*"
+		}
+	}
+	for _, patterns := range [][]string{f.Actions, f.ResourceTypes, f.Resources, f.Users, f.Clients} {
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("Invalid pattern '%s': %s", pattern, err.Error())
+			}
+		}
+	}
+	return nil
+}
+
+// matchGlobs is whether any pattern matches any value, or if there are no
+// patterns
+func matchGlobs(patterns []string, values ...string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		for _, value := range values {
+			if ok, _ := path.Match(pattern, value); ok && value != "" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchAction matches actions, or actions and states given as action:state
+func (f *eventFilter) matchAction(e *event) bool {
+	if len(f.Actions) == 0 {
+		return true
+	}
+	for _, pattern := range f.Actions {
+		value := e.Action
+		if strings.Contains(pattern, ":") {
+			value += ":" + e.State
+		}
+		if ok, _ := path.Match(pattern, value); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Match is whether an event passes the filter. Resources match if the event
+// is about them, affects them or touches them.
+func (f *eventFilter) Match(e *event) bool {
+	if !f.matchAction(e) {
+		return false
+	}
+	var ids, names []string
+	for _, r := range append([]eventResource{e.Resource}, append(e.Affects, e.Touches...)...) {
+		ids = append(ids, r.Id)
+		names = append(names, r.Name)
+	}
+	var email string
+	if e.User.Email != nil {
+		email = *e.User.Email
+	}
+	return matchGlobs(f.ResourceTypes, ids...) &&
+		matchGlobs(f.Resources, append(ids, names...)...) &&
+		matchGlobs(f.Users, email, e.User.Id, e.User.Name) &&
+		matchGlobs(f.Clients, e.Client.Id, e.Client.Name)
+}
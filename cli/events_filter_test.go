@@ -0,0 +1,105 @@
+package cli
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const testEventPayload = `{
+	"id": "evt-aaaaa",
+	"action": "map",
+	"state": "completed",
+	"resource": {"id": "cip-web01", "name": "prod-web-ip"},
+	"affects": [{"id": "cip-web01", "name": "prod-web-ip"}, {"id": "srv-web01", "name": "prod-web-1"}],
+	"touches": [{"id": "grp-webbb", "name": "prod-web"}],
+	"user": {"id": "usr-jjjjj", "name": "John", "email": "john@example.com"},
+	"client": {"id": "cli-deplo", "name": "deploy"}
+}`
+
+func testReceivedEvent(t *testing.T) *receivedEvent {
+	e, err := decodeEvent(time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC), json.RawMessage(testEventPayload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func TestEventFilterCheck(t *testing.T) {
+	f := eventFilter{ResourceTypes: []string{"srv-", "cip", "img-*"}}
+	if err := f.check(); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"srv-*", "cip-*", "img-*"}; !reflect.DeepEqual(f.ResourceTypes, want) {
+		t.Errorf("got resource types %q, want %q", f.ResourceTypes, want)
+	}
+
+	f = eventFilter{Users: []string{"[john"}}
+	if err := f.check(); err == nil {
+		t.Error("expected an error checking an invalid pattern")
+	}
+}
+
+func TestEventFilterMatch(t *testing.T) {
+	e, err := decodeEvent(time.Now(), json.RawMessage(testEventPayload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		filter eventFilter
+		want   bool
+	}{
+		{"no filter", eventFilter{}, true},
+		{"action", eventFilter{Actions: []string{"map"}}, true},
+		{"action glob", eventFilter{Actions: []string{"create", "ma*"}}, true},
+		{"other action", eventFilter{Actions: []string{"unmap"}}, false},
+		{"action and state", eventFilter{Actions: []string{"map:completed"}}, true},
+		{"action and other state", eventFilter{Actions: []string{"map:failed"}}, false},
+		{"any action in a state", eventFilter{Actions: []string{"*:completed"}}, true},
+		{"resource type", eventFilter{ResourceTypes: []string{"cip"}}, true},
+		{"affected resource type", eventFilter{ResourceTypes: []string{"srv-"}}, true},
+		{"touched resource type", eventFilter{ResourceTypes: []string{"grp-"}}, true},
+		{"other resource type", eventFilter{ResourceTypes: []string{"img-"}}, false},
+		{"resource id", eventFilter{Resources: []string{"cip-web01"}}, true},
+		{"resource name", eventFilter{Resources: []string{"prod-*-ip"}}, true},
+		{"affected resource name", eventFilter{Resources: []string{"prod-web-1"}}, true},
+		{"touched resource id", eventFilter{Resources: []string{"grp-webbb"}}, true},
+		{"other resource", eventFilter{Resources: []string{"prod-db*"}}, false},
+		{"user email", eventFilter{Users: []string{"*@example.com"}}, true},
+		{"user id", eventFilter{Users: []string{"usr-jjjjj"}}, true},
+		{"user name", eventFilter{Users: []string{"John"}}, true},
+		{"other user", eventFilter{Users: []string{"jane@example.com"}}, false},
+		{"client id", eventFilter{Clients: []string{"cli-deplo"}}, true},
+		{"client name", eventFilter{Clients: []string{"dep*"}}, true},
+		{"other client", eventFilter{Clients: []string{"cli-other"}}, false},
+		{"all match", eventFilter{Actions: []string{"map"}, ResourceTypes: []string{"srv-"}, Users: []string{"John"}, Clients: []string{"deploy"}}, true},
+		{"one doesn't match", eventFilter{Actions: []string{"map"}, ResourceTypes: []string{"srv-"}, Users: []string{"Jane"}}, false},
+	}
+	for _, test := range tests {
+		if err := test.filter.check(); err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err)
+			continue
+		}
+		if got := test.filter.Match(&e.event); got != test.want {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestEventFilterMatchEmptyFields(t *testing.T) {
+	e, err := decodeEvent(time.Now(), json.RawMessage(`{"id": "evt-bbbbb", "action": "destroy", "resource": {"id": "srv-aaaaa"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []eventFilter{
+		{Users: []string{"*"}},
+		{Clients: []string{"*"}},
+		{Resources: []string{"*-web*"}},
+	} {
+		if f.Match(&e.event) {
+			t.Errorf("filter %+v matched an event without those fields", f)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package cli
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"gopkg.in/alecthomas/kingpin.v2"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	forwardTimeout    = 30 * time.Second
+	forwardMinBackoff = time.Second
+	forwardMaxBackoff = 5 * time.Minute
+	// forwardSignatureHeader holds the HMAC-SHA256 of the request body,
+	// keyed with the shared secret, as sha256=<hex>
+	forwardSignatureHeader = "X-Brightbox-Signature"
+)
+
+// eventForwarder POSTs events as JSON to a webhook. Events are queued on
+// disk first, one file per event, so they are delivered in order even if
+// the forwarder is restarted or the webhook is down for a while.
+type eventForwarder struct {
+	url    string
+	secret []byte
+	dir    string
+	client *http.Client
+	wake   chan struct{}
+}
+
+func newEventForwarder(url, secret, dir string) (*eventForwarder, error) {
+	if err := os.MkdirAll(filepath.Join(dir, "failed"), 0700); err != nil {
+		return nil, err
+	}
+	return &eventForwarder{
+		url:    url,
+		secret: []byte(secret),
+		dir:    dir,
+		client: &http.Client{Timeout: forwardTimeout},
+		wake:   make(chan struct{}, 1),
+	}, nil
+}
+
+// forwardQueueDir is the default queue for a webhook, which is kept apart
+// from the queues for any others
+func forwardQueueDir(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return xdgapp.CachePath("events-forward-" + hex.EncodeToString(sum[:])[:12])
+}
+
+// enqueue saves an event to the queue. File names start with the time the
+// event was queued, so they sort in the order to deliver them.
+func (f *eventForwarder) enqueue(e *receivedEvent) error {
+	data, err := e.JSON()
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%020d-%s.json", time.Now().UnixNano(), strings.Replace(e.Id, "/", "_", -1))
+	if err = writeFileAtomically(filepath.Join(f.dir, name), data, 0600); err != nil {
+		return err
+	}
+	select {
+	case f.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// pending lists the queued events, oldest first. Files being written start
+// with a dot, so are left out.
+func (f *eventForwarder) pending() ([]string, error) {
+	entries, err := ioutil.ReadDir(f.dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, fi := range entries {
+		if fi.Mode().IsRegular() && !strings.HasPrefix(fi.Name(), ".") && strings.HasSuffix(fi.Name(), ".json") {
+			names = append(names, fi.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// requeueFailed moves the events the webhook rejected back into the queue.
+// They keep their names, so are delivered before anything queued since.
+func (f *eventForwarder) requeueFailed() (int, error) {
+	failed := filepath.Join(f.dir, "failed")
+	entries, err := ioutil.ReadDir(failed)
+	if err != nil {
+		return 0, err
+	}
+	var moved int
+	for _, fi := range entries {
+		if !fi.Mode().IsRegular() || !strings.HasSuffix(fi.Name(), ".json") {
+			continue
+		}
+		if err := os.Rename(filepath.Join(failed, fi.Name()), filepath.Join(f.dir, fi.Name())); err != nil {
+			return moved, err
+		}
+		moved++
+	}
+	return moved, nil
+}
+
+// deliverAll delivers queued events for as long as the forwarder runs,
+// waiting for more whenever the queue is empty
+func (f *eventForwarder) deliverAll() {
+	for {
+		names, err := f.pending()
+		if err != nil {
+			log.Printf("Couldn't read event queue: %s", err.Error())
+		}
+		if len(names) == 0 {
+			select {
+			case <-f.wake:
+			case <-time.After(time.Minute):
+			}
+			continue
+		}
+		for _, name := range names {
+			f.deliverQueued(name)
+		}
+	}
+}
+
+// deliverQueued delivers one queued event, retrying with exponential backoff
+// until the webhook accepts it. Events the webhook rejects outright are moved
+// aside to the failed directory.
+func (f *eventForwarder) deliverQueued(name string) {
+	path := filepath.Join(f.dir, name)
+	backoff := forwardMinBackoff
+	for {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			log.Printf("Couldn't read queued event %s: %s", name, err.Error())
+			return
+		}
+		retry, err := f.post(data)
+		if err == nil {
+			os.Remove(path)
+			return
+		}
+		if !retry {
+			log.Printf("Webhook rejected event %s, moving it to %s: %s", name, filepath.Join(f.dir, "failed"), err.Error())
+			os.Rename(path, filepath.Join(f.dir, "failed", name))
+			return
+		}
+		log.Printf("Couldn't forward event %s, retrying in %s: %s", name, backoff, err.Error())
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > forwardMaxBackoff {
+			backoff = forwardMaxBackoff
+		}
+	}
+}
+
+func (f *eventForwarder) signature(body []byte) string {
+	mac := hmac.New(sha256.New, f.secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// post sends an event to the webhook. Failures are worth retrying unless the
+// webhook rejected the event as a client error, other than for a timeout or
+// rate limit. Authentication failures are retried too, since they come from
+// a wrong secret or webhook token rather than the event, and restarting with
+// the right one should deliver it.
+func (f *eventForwarder) post(body []byte) (retry bool, err error) {
+	req, err := http.NewRequest("POST", f.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(forwardSignatureHeader, f.signature(body))
+	res, err := f.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	io.Copy(ioutil.Discard, res.Body)
+	res.Body.Close()
+	switch {
+	case res.StatusCode >= 200 && res.StatusCode <= 299:
+		return false, nil
+	case res.StatusCode == http.StatusRequestTimeout, res.StatusCode == http.StatusTooManyRequests,
+		res.StatusCode == http.StatusUnauthorized, res.StatusCode == http.StatusForbidden:
+		return true, fmt.Errorf("%s", res.Status)
+	case res.StatusCode >= 400 && res.StatusCode <= 499:
+		return false, fmt.Errorf("%s", res.Status)
+	}
+	return true, fmt.Errorf("%s", res.Status)
+}
+
+func (l *eventsCommand) forward(pc *kingpin.ParseContext) error {
+	err := l.EventFilter.check()
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(l.URL, "http://") && !strings.HasPrefix(l.URL, "https://") {
+		return fmt.Errorf("The webhook URL must be http or https")
+	}
+	err = l.Configure()
+	if err != nil {
+		return err
+	}
+	if l.QueueDir == "" {
+		l.QueueDir = forwardQueueDir(l.URL)
+	}
+	forwarder, err := newEventForwarder(l.URL, l.Secret, l.QueueDir)
+	if err != nil {
+		return err
+	}
+	if l.RequeueFailed {
+		moved, err := forwarder.requeueFailed()
+		if err != nil {
+			return err
+		}
+		log.Printf("Requeued %d failed events", moved)
+	}
+	go forwarder.deliverAll()
+
+	return l.subscribe(func(e *receivedEvent) {
+		if err := forwarder.enqueue(e); err != nil {
+			log.Printf("Couldn't queue event %s: %s", e.Id, err.Error())
+		}
+	})
+}
@@ -0,0 +1,143 @@
+package cli
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// testWebhook records the requests it gets, and responds with status
+type testWebhook struct {
+	status int
+	bodies []string
+	sigs   []string
+}
+
+func (w *testWebhook) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	w.bodies = append(w.bodies, string(body))
+	w.sigs = append(w.sigs, r.Header.Get(forwardSignatureHeader))
+	rw.WriteHeader(w.status)
+}
+
+func newTestForwarder(t *testing.T, url string) *eventForwarder {
+	dir, err := ioutil.TempDir("", "brightbox-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := newEventForwarder(url, "s3cret", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestEventForwarderPost(t *testing.T) {
+	tests := []struct {
+		status int
+		err    bool
+		retry  bool
+	}{
+		{200, false, false},
+		{204, false, false},
+		{400, true, false},
+		{401, true, true},
+		{403, true, true},
+		{404, true, false},
+		{408, true, true},
+		{422, true, false},
+		{429, true, true},
+		{500, true, true},
+		{503, true, true},
+	}
+	webhook := new(testWebhook)
+	server := httptest.NewServer(webhook)
+	defer server.Close()
+	f := newTestForwarder(t, server.URL)
+	defer os.RemoveAll(f.dir)
+	for _, test := range tests {
+		webhook.status = test.status
+		retry, err := f.post([]byte(`{"id":"evt-aaaaa"}`))
+		if (err != nil) != test.err || retry != test.retry {
+			t.Errorf("%d: got retry %v and error %v, want retry %v and error %v", test.status, retry, err, test.retry, test.err)
+		}
+	}
+
+	server.Close()
+	if retry, err := f.post([]byte(`{}`)); err == nil || !retry {
+		t.Errorf("got retry %v and error %v posting to a closed webhook, want a retry", retry, err)
+	}
+}
+
+func TestEventForwarderSignature(t *testing.T) {
+	webhook := &testWebhook{status: 200}
+	server := httptest.NewServer(webhook)
+	defer server.Close()
+	f := newTestForwarder(t, server.URL)
+	defer os.RemoveAll(f.dir)
+
+	body := `{"id":"evt-aaaaa","action":"destroy"}`
+	if _, err := f.post([]byte(body)); err != nil {
+		t.Fatal(err)
+	}
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write([]byte(body))
+	want := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	if webhook.bodies[0] != body || webhook.sigs[0] != want {
+		t.Errorf("got body %q signed %q, want %q signed %q", webhook.bodies[0], webhook.sigs[0], body, want)
+	}
+}
+
+func TestEventForwarderQueue(t *testing.T) {
+	webhook := &testWebhook{status: 200}
+	server := httptest.NewServer(webhook)
+	defer server.Close()
+	f := newTestForwarder(t, server.URL)
+	defer os.RemoveAll(f.dir)
+
+	e := testReceivedEvent(t)
+	for _, id := range []string{"evt-aaaaa", "evt-bbbbb"} {
+		e.Id = id
+		if err := f.enqueue(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	names, err := f.pending()
+	if err != nil || len(names) != 2 {
+		t.Fatalf("got queue %q and error %v, want 2 events", names, err)
+	}
+
+	// Rejected events are moved aside, and can be requeued
+	webhook.status = 422
+	f.deliverQueued(names[0])
+	webhook.status = 200
+	f.deliverQueued(names[1])
+	if pending, _ := f.pending(); len(pending) != 0 {
+		t.Errorf("got queue %q, want it empty", pending)
+	}
+	if _, err := os.Stat(filepath.Join(f.dir, "failed", names[0])); err != nil {
+		t.Errorf("rejected event wasn't moved to failed: %s", err)
+	}
+
+	moved, err := f.requeueFailed()
+	if err != nil || moved != 1 {
+		t.Errorf("got %d requeued and error %v, want 1", moved, err)
+	}
+	if pending, _ := f.pending(); !reflect.DeepEqual(pending, names[:1]) {
+		t.Errorf("got queue %q, want %q", pending, names[:1])
+	}
+	f.deliverQueued(names[0])
+	if pending, _ := f.pending(); len(pending) != 0 {
+		t.Errorf("got queue %q, want it empty", pending)
+	}
+	if len(webhook.bodies) != 3 {
+		t.Errorf("webhook got %d requests, want 3", len(webhook.bodies))
+	}
+}
@@ -0,0 +1,233 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/websocket"
+	"golang.org/x/oauth2"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// eventsDefaultTimeout is how long the server may hold a connect
+	// request open, unless it advises otherwise
+	eventsDefaultTimeout = 60 * time.Second
+	// eventsKeepalive is how often the connection is pinged, and how much
+	// longer than the advised timeout to wait before giving up on it
+	eventsKeepalive  = 30 * time.Second
+	eventsMinBackoff = time.Second
+	eventsMaxBackoff = 2 * time.Minute
+	// eventsTokenMargin is how long before the OAuth token expires that the
+	// subscription is renewed with a new one
+	eventsTokenMargin = 5 * time.Minute
+)
+
+var errEventsRehandshake = errors.New("Server asked for a new handshake")
+
+// eventStream is a subscription to an account's events. It follows the
+// server's Bayeux advice and reconnects whenever the connection drops.
+type eventStream struct {
+	client  *Client
+	account string
+	url     string
+	// The server's advice, as how to reconnect, how long to wait between
+	// connect requests and how long it may hold them open
+	reconnect string
+	interval  time.Duration
+	timeout   time.Duration
+	token     *oauth2.Token
+	handle    func(received time.Time, data json.RawMessage)
+}
+
+func (c *Client) eventStream(account string, handle func(time.Time, json.RawMessage)) *eventStream {
+	return &eventStream{
+		client:    c,
+		account:   account,
+		url:       "wss://events." + c.findRegionDomain() + "/stream",
+		reconnect: "retry",
+		timeout:   eventsDefaultTimeout,
+		handle:    handle,
+	}
+}
+
+// run receives events until the server advises not to reconnect. Dropped
+// connections, and handshakes the server asks for, are retried with
+// exponential backoff, which starts again from the minimum once a
+// subscription succeeds. A handshake never waits less than the server's
+// advised interval.
+func (s *eventStream) run() error {
+	backoff := eventsMinBackoff
+	for {
+		subscribed, err := s.session()
+		if s.reconnect == "none" {
+			return err
+		}
+		if subscribed {
+			backoff = eventsMinBackoff
+		}
+		wait := backoff
+		if err == errEventsRehandshake && s.interval > wait {
+			wait = s.interval
+		}
+		if backoff *= 2; backoff > eventsMaxBackoff {
+			backoff = eventsMaxBackoff
+		}
+		log.Printf("Event stream disconnected: %s. Reconnecting in %s", err, wait)
+		time.Sleep(wait)
+	}
+}
+
+// follow takes the server's advice, which may be given with any reply
+func (s *eventStream) follow(advice *fayeAdvice) {
+	if advice == nil {
+		return
+	}
+	if advice.Reconnect != "" {
+		s.reconnect = advice.Reconnect
+	}
+	if advice.Interval != nil {
+		s.interval = time.Duration(*advice.Interval) * time.Millisecond
+	}
+	if advice.Timeout != nil {
+		s.timeout = time.Duration(*advice.Timeout) * time.Millisecond
+	}
+}
+
+// extendDeadline gives the server until its advised timeout, and some, to
+// send anything else before the connection is given up on
+func (s *eventStream) extendDeadline(ws *websocket.Conn) error {
+	return ws.SetReadDeadline(time.Now().Add(s.timeout + eventsKeepalive))
+}
+
+func (s *eventStream) keepalive(ws *websocket.Conn, stop chan struct{}) {
+	ticker := time.NewTicker(eventsKeepalive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(eventsKeepalive))
+		}
+	}
+}
+
+func (s *eventStream) tokenExpiring() bool {
+	return s.token != nil && !s.token.Expiry.IsZero() && time.Until(s.token.Expiry) < eventsTokenMargin
+}
+
+// subscription is a request to subscribe to the account's events, with an
+// OAuth token that won't expire soon
+func (s *eventStream) subscription(cid string) (*fayeMsg, error) {
+	token, err := s.client.Token()
+	if err != nil {
+		return nil, err
+	}
+	s.token = token
+	if s.tokenExpiring() {
+		if s.token, err = s.client.RefreshToken(); err != nil {
+			return nil, err
+		}
+	}
+	return &fayeMsg{
+		Channel:      "/meta/subscribe",
+		ClientId:     cid,
+		Subscription: "/account/" + s.account,
+		Ext:          &fayeAuth{AuthToken: s.token.AccessToken},
+	}, nil
+}
+
+// session connects, handshakes and subscribes, then receives events until
+// the connection fails or the server advises a new handshake
+func (s *eventStream) session() (subscribed bool, err error) {
+	dialer := websocket.Dialer{Proxy: http.ProxyFromEnvironment, HandshakeTimeout: eventsKeepalive}
+	ws, _, err := dialer.Dial(s.url, nil)
+	if err != nil {
+		return false, err
+	}
+	defer ws.Close()
+	stop := make(chan struct{})
+	defer close(stop)
+	go s.keepalive(ws, stop)
+	ws.SetPongHandler(func(string) error { return s.extendDeadline(ws) })
+
+	handshake := fayeMsg{
+		Channel:                  "/meta/handshake",
+		Version:                  "1.0",
+		SupportedConnectionTypes: []string{"websocket"},
+	}
+	if err = sendmsg(ws, &handshake); err != nil {
+		return false, err
+	}
+	s.extendDeadline(ws)
+	msgl, err := recvmsg(ws)
+	if err != nil {
+		return false, err
+	}
+	if len(msgl) == 0 {
+		return false, fmt.Errorf("Event handshake failure: no reply")
+	}
+	reply := msgl[0]
+	s.reconnect = "retry"
+	s.follow(reply.Advice)
+	if !reply.Successful {
+		return false, fmt.Errorf("Event handshake failure: %s", reply.Error)
+	}
+
+	connect := fayeMsg{
+		Channel:        "/meta/connect",
+		ClientId:       reply.ClientId,
+		ConnectionType: "websocket",
+	}
+	subscribe, err := s.subscription(reply.ClientId)
+	if err != nil {
+		return false, err
+	}
+	if err = sendmsg(ws, &connect, subscribe); err != nil {
+		return false, err
+	}
+	for {
+		s.extendDeadline(ws)
+		msgl, err := recvmsg(ws)
+		if err != nil {
+			return subscribed, err
+		}
+		received := time.Now()
+		for _, msg := range msgl {
+			switch {
+			case msg.Channel == "/meta/subscribe":
+				if !msg.Successful {
+					return subscribed, fmt.Errorf("Event subscription failure: %s", msg.Error)
+				}
+				subscribed = true
+			case msg.Channel == "/meta/connect":
+				s.follow(msg.Advice)
+				switch {
+				case s.reconnect == "none" && msg.Error != "":
+					return subscribed, fmt.Errorf("Event connection failure: %s", msg.Error)
+				case s.reconnect == "none":
+					return subscribed, errors.New("Event connection closed by the server")
+				case s.reconnect == "handshake", !msg.Successful && msg.Advice == nil:
+					return subscribed, errEventsRehandshake
+				}
+				time.Sleep(s.interval)
+				msgs := []*fayeMsg{&connect}
+				if s.tokenExpiring() {
+					if subscribe, err = s.subscription(reply.ClientId); err != nil {
+						return subscribed, err
+					}
+					msgs = append(msgs, subscribe)
+				}
+				if err = sendmsg(ws, msgs...); err != nil {
+					return subscribed, err
+				}
+			case msg.Data != nil && strings.HasPrefix(msg.Channel, "/account/acc"):
+				s.handle(received, *msg.Data)
+			}
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/brightbox/gobrightbox"
+	"gopkg.in/alecthomas/kingpin.v2"
+	"gopkg.in/yaml.v2"
+	"os"
+	"sort"
+	"strings"
+)
+
+var exportResources = []string{"servers", "groups", "cloudips", "images"}
+
+type exportCommand struct {
+	*CLIApp
+	Resources string
+	Label     string
+}
+
+// exporter builds a manifest from an account. References between resources
+// are made by name, where the name is unique, otherwise by identifier.
+type exporter struct {
+	st       *liveState
+	label    string
+	warnings []string
+}
+
+// Resources without a unique name can't be matched by apply, so aren't
+// exported. Those not named with the label aren't exported either.
+func (e *exporter) exportable(kind, id, name string) bool {
+	if !strings.HasPrefix(name, e.label) {
+		return false
+	}
+	if name == "" {
+		e.warnings = append(e.warnings, fmt.Sprintf("Skipping %s %s, which has no name", kind, id))
+		return false
+	}
+	if _, err := e.st.lookup(kind, name); err != nil {
+		e.warnings = append(e.warnings, fmt.Sprintf("Skipping %s %s: %s", kind, id, err.Error()))
+		return false
+	}
+	return true
+}
+
+// ref refers to a resource by name if that is unique, otherwise by identifier
+func (e *exporter) ref(kind, id string) string {
+	name := e.st.names[id]
+	if name == "" {
+		return id
+	}
+	if found, err := e.st.lookup(kind, name); err != nil || found != id {
+		return id
+	}
+	return name
+}
+
+// destinationRef refers to a Cloud IP's destination by name if apply would
+// map to the same resource by that name, otherwise by identifier
+func (e *exporter) destinationRef(id string) string {
+	name := e.st.names[id]
+	if name == "" {
+		return id
+	}
+	if found, err := e.st.destinationId(name); err != nil || found != id {
+		return id
+	}
+	return name
+}
+
+func (e *exporter) serverGroups() []manifestServerGroup {
+	var groups []manifestServerGroup
+	for _, g := range e.st.groups {
+		if !e.exportable("server group", g.Id, g.Name) {
+			continue
+		}
+		description := g.Description
+		groups = append(groups, manifestServerGroup{Name: g.Name, Description: &description})
+	}
+	return groups
+}
+
+func (e *exporter) servers() []manifestServer {
+	var servers []manifestServer
+	for _, s := range e.st.servers {
+		if !e.exportable("server", s.Id, s.Name) {
+			continue
+		}
+		compatibilityMode := s.CompatibilityMode
+		ms := manifestServer{
+			Name:              s.Name,
+			Image:             s.Image.Id,
+			Type:              s.ServerType.Handle,
+			Zone:              s.Zone.Handle,
+			Groups:            []string{},
+			CompatibilityMode: &compatibilityMode,
+		}
+		for _, g := range s.ServerGroups {
+			ms.Groups = append(ms.Groups, e.ref("server group", g.Id))
+		}
+		sort.Strings(ms.Groups)
+		servers = append(servers, ms)
+	}
+	return servers
+}
+
+func (e *exporter) cloudIPs() []manifestCloudIP {
+	var cloudIPs []manifestCloudIP
+	for i := range e.st.cloudIPs {
+		cip := &e.st.cloudIPs[i]
+		if !e.exportable("Cloud IP", cip.Id, cip.Name) {
+			continue
+		}
+		reverseDns := cip.ReverseDns
+		mc := manifestCloudIP{Name: cip.Name, ReverseDns: &reverseDns}
+		if len(cip.PortTranslators) > 0 {
+			pts := formatPortTranslators(cip.PortTranslators)
+			mc.PortTranslators = &pts
+		}
+		dest := e.destinationRef(cloudIPDestinationId(cip))
+		mc.Map = &dest
+		cloudIPs = append(cloudIPs, mc)
+	}
+	return cloudIPs
+}
+
+func (e *exporter) images(images []brightbox.Image, accountId string) []manifestImage {
+	var exported []manifestImage
+	for _, img := range images {
+		if img.Official || img.Owner != accountId || img.Status == "deleted" {
+			continue
+		}
+		if !strings.HasPrefix(img.Name, e.label) {
+			continue
+		}
+		exported = append(exported, manifestImage{
+			Id:          img.Id,
+			Name:        img.Name,
+			Description: img.Description,
+			Arch:        img.Arch,
+			Username:    img.Username,
+		})
+	}
+	return exported
+}
+
+func (l *exportCommand) export(pc *kingpin.ParseContext) error {
+	// Manifests are YAML unless json is asked for, so the default text
+	// format means yaml
+	if l.Format != "text" && l.Format != "yaml" && l.Format != "json" {
+		return fmt.Errorf("Manifests can only be exported in yaml or json format")
+	}
+	err := l.Configure()
+	if err != nil {
+		return err
+	}
+	resources := make(map[string]bool)
+	for _, r := range strings.Split(l.Resources, ",") {
+		if err = checkExportResource(r); err != nil {
+			return err
+		}
+		resources[r] = true
+	}
+
+	st, err := l.Client.fetchLiveState()
+	if err != nil {
+		return err
+	}
+	e := &exporter{st: st, label: l.Label}
+	m := manifest{Label: l.Label}
+	if resources["groups"] {
+		m.ServerGroups = e.serverGroups()
+	}
+	if resources["servers"] {
+		m.Servers = e.servers()
+	}
+	if resources["cloudips"] {
+		m.CloudIPs = e.cloudIPs()
+	}
+	if resources["images"] {
+		images, err := l.Client.Images()
+		if err != nil {
+			return err
+		}
+		m.Images = e.images(images, l.accountId())
+	}
+	for _, w := range e.warnings {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", w)
+	}
+
+	var out []byte
+	if l.Format == "json" {
+		out, err = json.MarshalIndent(m, "", "  ")
+		out = append(out, '\n')
+	} else {
+		out, err = yaml.Marshal(m)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(out)
+	return err
+}
+
+func checkExportResource(r string) error {
+	for _, er := range exportResources {
+		if r == er {
+			return nil
+		}
+	}
+	return fmt.Errorf("Unknown resource '%s', must be one of: %s", r, strings.Join(exportResources, ", "))
+}
+
+func configureExportCommand(app *CLIApp) {
+	cmd := exportCommand{CLIApp: app}
+	export := app.Command("export", "Write a manifest of the resources in the account, for apply").
+		Action(cmd.export)
+	export.Flag("resources", "Which resources to export: "+strings.Join(exportResources, ", ")).
+		Default(strings.Join(exportResources, ",")).StringVar(&cmd.Resources)
+	export.Flag("label", "Only export resources whose names start with this label, and label the manifest with it").
+		StringVar(&cmd.Label)
+}
@@ -0,0 +1,54 @@
+package cli
+
+import (
+	"github.com/brightbox/gobrightbox"
+	"strings"
+	"testing"
+)
+
+func TestExportCloudIPDestinations(t *testing.T) {
+	st := testLiveState()
+	st.add("load balancer", "prod-lb", "lba-lbweb")
+	st.add("database server", "prod-db", "dbs-dbweb")
+	st.add("load balancer", "prod-web-1", "lba-clash")
+	for _, m := range []struct{ id, name, dest string }{
+		{"cip-lbweb", "prod-lb-ip", "lba-lbweb"},
+		{"cip-dbweb", "prod-db-ip", "dbs-dbweb"},
+		{"cip-clash", "prod-clash-ip", "lba-clash"},
+	} {
+		var cip brightbox.CloudIP
+		cip.Id, cip.Name, cip.Status = m.id, m.name, "mapped"
+		if strings.HasPrefix(m.dest, "lba-") {
+			cip.LoadBalancer = new(brightbox.LoadBalancer)
+			cip.LoadBalancer.Id = m.dest
+		} else {
+			cip.DatabaseServer = new(brightbox.DatabaseServer)
+			cip.DatabaseServer.Id = m.dest
+		}
+		st.cloudIPs = append(st.cloudIPs, cip)
+		st.add("Cloud IP", cip.Name, cip.Id)
+	}
+
+	e := &exporter{st: st, label: "prod-"}
+	m := manifest{Label: "prod-", ServerGroups: e.serverGroups(), Servers: e.servers(), CloudIPs: e.cloudIPs()}
+	want := map[string]string{
+		"prod-web-ip":   "prod-web-1",
+		"prod-lb-ip":    "prod-lb",
+		"prod-db-ip":    "prod-db",
+		"prod-clash-ip": "lba-clash",
+	}
+	for _, mc := range m.CloudIPs {
+		if mc.Map == nil || *mc.Map != want[mc.Name] {
+			t.Errorf("%s: got map %v, want %s", mc.Name, mc.Map, want[mc.Name])
+		}
+	}
+
+	// The exported manifest must match the account it came from
+	actions, err := st.plan(&m, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(actions) > 0 {
+		t.Errorf("got plan %q for the exported manifest, want no changes", planSummary(actions))
+	}
+}
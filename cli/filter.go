@@ -0,0 +1,141 @@
+package cli
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// The filter operators, longest first so that ">=" is found before ">"
+var filterOperators = []string{"!=", "!~", ">=", "<=", "=", "~", ">", "<"}
+
+// fieldFilter is a list of conditions on the fields of a resource, all of
+// which must hold for the resource to match
+type fieldFilter struct {
+	conditions []filterCondition
+}
+
+type filterCondition struct {
+	field string
+	op    string
+	value string
+	regex *regexp.Regexp
+}
+
+// parseFieldFilter parses a comma separated list of conditions such as
+// "status=active,zone=gb1-a,name~^web-,ram>=4096". A comma can be included in
+// a value by escaping it with a backslash.
+func parseFieldFilter(expr string) (*fieldFilter, error) {
+	ff := new(fieldFilter)
+	for _, term := range splitFilterTerms(expr) {
+		if strings.TrimSpace(term) == "" {
+			continue
+		}
+		c, err := parseFilterCondition(term)
+		if err != nil {
+			return nil, err
+		}
+		ff.conditions = append(ff.conditions, *c)
+	}
+	return ff, nil
+}
+
+func splitFilterTerms(expr string) []string {
+	var terms []string
+	var term strings.Builder
+	for i := 0; i < len(expr); i++ {
+		switch {
+		case expr[i] == '\\' && i+1 < len(expr) && expr[i+1] == ',':
+			term.WriteByte(',')
+			i++
+		case expr[i] == ',':
+			terms = append(terms, term.String())
+			term.Reset()
+		default:
+			term.WriteByte(expr[i])
+		}
+	}
+	return append(terms, term.String())
+}
+
+func parseFilterCondition(term string) (*filterCondition, error) {
+	n := strings.IndexAny(term, "=!~<>")
+	if n <= 0 {
+		return nil, fmt.Errorf("Invalid filter '%s', expected a field, an operator and a value", term)
+	}
+	c := &filterCondition{field: strings.TrimSpace(term[:n])}
+	for _, op := range filterOperators {
+		if strings.HasPrefix(term[n:], op) {
+			c.op = op
+			c.value = term[n+len(op):]
+			break
+		}
+	}
+	switch c.op {
+	case "":
+		return nil, fmt.Errorf("Invalid operator in filter '%s'", term)
+	case "~", "!~":
+		re, err := regexp.Compile(c.value)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid regular expression in filter '%s': %s", term, err)
+		}
+		c.regex = re
+	}
+	return c, nil
+}
+
+// Match reports whether the fields satisfy every condition of the filter. It
+// is an error to filter on a field that doesn't exist.
+func (ff *fieldFilter) Match(fields map[string]string) (bool, error) {
+	for _, c := range ff.conditions {
+		value, ok := fields[c.field]
+		if !ok {
+			return false, fmt.Errorf("Unknown field '%s' in filter", c.field)
+		}
+		if !c.match(value) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func (c *filterCondition) match(value string) bool {
+	switch c.op {
+	case "=":
+		return filterValueEqual(value, c.value)
+	case "!=":
+		return !filterValueEqual(value, c.value)
+	case "~":
+		return c.regex.MatchString(value)
+	case "!~":
+		return !c.regex.MatchString(value)
+	}
+	cmp := compareFieldValues(value, c.value)
+	switch c.op {
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	}
+	return false
+}
+
+// Fields holding lists, such as server_groups, are equal to a value if any of
+// their members are.
+func filterValueEqual(value, want string) bool {
+	if value == want {
+		return true
+	}
+	if strings.Contains(value, ",") {
+		for _, v := range strings.Split(value, ",") {
+			if v == want {
+				return true
+			}
+		}
+	}
+	return false
+}
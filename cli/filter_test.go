@@ -0,0 +1,109 @@
+package cli
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseFieldFilter(t *testing.T) {
+	tests := []struct {
+		expr string
+		want []filterCondition
+	}{
+		{"", nil},
+		{"status=active", []filterCondition{{field: "status", op: "=", value: "active"}}},
+		{"ram>=4096,zone!=gb1-a", []filterCondition{
+			{field: "ram", op: ">=", value: "4096"},
+			{field: "zone", op: "!=", value: "gb1-a"},
+		}},
+		{"ram>4096", []filterCondition{{field: "ram", op: ">", value: "4096"}}},
+		{"ram<=4096", []filterCondition{{field: "ram", op: "<=", value: "4096"}}},
+		{" status =active,", []filterCondition{{field: "status", op: "=", value: "active"}}},
+		{`name=a\,b`, []filterCondition{{field: "name", op: "=", value: "a,b"}}},
+		{"name=", []filterCondition{{field: "name", op: "=", value: ""}}},
+	}
+	for _, test := range tests {
+		ff, err := parseFieldFilter(test.expr)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %s", test.expr, err)
+			continue
+		}
+		if !reflect.DeepEqual(ff.conditions, test.want) {
+			t.Errorf("%q: got %+v, want %+v", test.expr, ff.conditions, test.want)
+		}
+	}
+}
+
+func TestParseFieldFilterRegex(t *testing.T) {
+	ff, err := parseFieldFilter("name~^web-,name!~db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ff.conditions) != 2 || ff.conditions[0].regex == nil || ff.conditions[1].regex == nil {
+		t.Fatalf("expected two regex conditions, got %+v", ff.conditions)
+	}
+}
+
+func TestParseFieldFilterErrors(t *testing.T) {
+	for _, expr := range []string{"=x", "status", "a!b", "name~[", "status=active,ram"} {
+		if _, err := parseFieldFilter(expr); err == nil {
+			t.Errorf("%q: expected an error", expr)
+		}
+	}
+}
+
+func TestFieldFilterMatch(t *testing.T) {
+	fields := map[string]string{
+		"status":        "active",
+		"zone":          "gb1-a",
+		"name":          "web-1",
+		"ram":           "4096",
+		"server_groups": "grp-aaaaa,grp-bbbbb",
+		"created_on":    "2018-03-01",
+	}
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{"", true},
+		{"status=active", true},
+		{"status=inactive", false},
+		{"status!=active", false},
+		{"status=active,zone=gb1-a,name~^web-", true},
+		{"status=active,zone=gb1-b", false},
+		{"name~^web-", true},
+		{"name!~^db-", true},
+		{"ram>=4096", true},
+		{"ram>4096", false},
+		{"ram<10000", true},
+		{"ram<=4095", false},
+		{"server_groups=grp-bbbbb", true},
+		{"server_groups=grp-ccccc", false},
+		{"server_groups!=grp-aaaaa", false},
+		{"created_on>=2018-01-01", true},
+		{"created_on<2018-01-01", false},
+	}
+	for _, test := range tests {
+		ff, err := parseFieldFilter(test.expr)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %s", test.expr, err)
+			continue
+		}
+		got, err := ff.Match(fields)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %s", test.expr, err)
+		} else if got != test.want {
+			t.Errorf("%q: got %v, want %v", test.expr, got, test.want)
+		}
+	}
+}
+
+func TestFieldFilterMatchUnknownField(t *testing.T) {
+	ff, err := parseFieldFilter("colour=red")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ff.Match(map[string]string{"name": "web-1"}); err == nil {
+		t.Error("expected an error for an unknown field")
+	}
+}
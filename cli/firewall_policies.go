@@ -0,0 +1,280 @@
+package cli
+
+import (
+	"fmt"
+	"github.com/brightbox/gobrightbox"
+	"gopkg.in/alecthomas/kingpin.v2"
+	"strings"
+)
+
+var (
+	defaultFirewallPolicyListFields = []string{"id", "server_group", "rules", "created", "name"}
+	defaultFirewallPolicyShowFields = []string{"id", "name", "default", "created_at", "server_group",
+		"rules", "rule_ids", "description"}
+)
+
+type firewallPoliciesCommand struct {
+	*CLIApp
+	Id          string
+	GroupId     string
+	IdList      []string
+	Name        *string
+	Description *string
+	Group       *string
+	Fields      string
+}
+
+func firewallPolicyFields(p *brightbox.FirewallPolicy) map[string]string {
+	var group string
+	if p.ServerGroup != nil {
+		group = p.ServerGroup.Id
+	}
+	return map[string]string{
+		"id":           p.Id,
+		"name":         p.Name,
+		"default":      formatBool(p.Default),
+		"created":      p.CreatedAt.Format("2006-01-02"),
+		"created_at":   formatTime(&p.CreatedAt),
+		"server_group": group,
+		"rules":        formatInt(len(p.Rules)),
+		"rule_ids":     collectById(p.Rules),
+		"description":  p.Description,
+	}
+}
+
+func (l *firewallPoliciesCommand) list(pc *kingpin.ParseContext) error {
+	err := l.Configure()
+	if err != nil {
+		return err
+	}
+	out, err := l.rowOutput(l.Fields)
+	if err != nil {
+		return err
+	}
+	policies, err := l.Client.FirewallPolicies()
+	if err != nil {
+		return err
+	}
+	for _, p := range policies {
+		if err = out.Write(firewallPolicyFields(&p), p); err != nil {
+			return err
+		}
+	}
+	return out.Flush()
+}
+
+func (l *firewallPoliciesCommand) show(pc *kingpin.ParseContext) error {
+	err := l.Configure()
+	if err != nil {
+		return err
+	}
+	l.Id, err = l.Client.firewallPolicyResolver().resolve(l.Id)
+	if err != nil {
+		return err
+	}
+	out, err := l.showOutput(l.Fields)
+	if err != nil {
+		return err
+	}
+	p, err := l.Client.FirewallPolicy(l.Id)
+	if err != nil {
+		l.Fatalf(err.Error())
+	}
+	if err = out.Write(firewallPolicyFields(p), p); err != nil {
+		return err
+	}
+	return out.Flush()
+}
+
+func (l *firewallPoliciesCommand) create(pc *kingpin.ParseContext) error {
+	err := l.Configure()
+	if err != nil {
+		return err
+	}
+	out, err := l.showOutput(l.Fields)
+	if err != nil {
+		return err
+	}
+	if l.Group != nil {
+		*l.Group, err = l.Client.serverGroupResolver().resolve(*l.Group)
+		if err != nil {
+			return err
+		}
+	}
+	newPolicy := brightbox.FirewallPolicyOptions{
+		Name:        l.Name,
+		Description: l.Description,
+		ServerGroup: l.Group,
+	}
+	policy, err := l.Client.CreateFirewallPolicy(&newPolicy)
+	if err != nil {
+		return err
+	}
+	if err = out.Write(firewallPolicyFields(policy), policy); err != nil {
+		return err
+	}
+	return out.Flush()
+}
+
+func (l *firewallPoliciesCommand) update(pc *kingpin.ParseContext) error {
+	err := l.Configure()
+	if err != nil {
+		return err
+	}
+	l.Id, err = l.Client.firewallPolicyResolver().resolve(l.Id)
+	if err != nil {
+		return err
+	}
+	out, err := l.showOutput(l.Fields)
+	if err != nil {
+		return err
+	}
+	updatePolicy := brightbox.FirewallPolicyOptions{
+		Id:          l.Id,
+		Name:        l.Name,
+		Description: l.Description,
+	}
+	policy, err := l.Client.UpdateFirewallPolicy(&updatePolicy)
+	if err != nil {
+		return err
+	}
+	if err = out.Write(firewallPolicyFields(policy), policy); err != nil {
+		return err
+	}
+	return out.Flush()
+}
+
+func (l *firewallPoliciesCommand) destroy(pc *kingpin.ParseContext) error {
+	err := l.Configure()
+	if err != nil {
+		return err
+	}
+	l.IdList, err = l.Client.firewallPolicyResolver().resolveAll(l.IdList)
+	if err != nil {
+		return err
+	}
+	returnError := false
+	for _, id := range l.IdList {
+		fmt.Printf("Destroying firewall policy %s\n", id)
+		err := l.Client.DestroyFirewallPolicy(id)
+		if err != nil {
+			l.Errorf("%s: %s", err.Error(), id)
+			returnError = true
+		}
+	}
+	if returnError {
+		return errGeneric
+	}
+	return nil
+}
+
+func (l *firewallPoliciesCommand) apply(pc *kingpin.ParseContext) error {
+	err := l.Configure()
+	if err != nil {
+		return err
+	}
+	l.Id, err = l.Client.firewallPolicyResolver().resolve(l.Id)
+	if err != nil {
+		return err
+	}
+	l.GroupId, err = l.Client.serverGroupResolver().resolve(l.GroupId)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Applying firewall policy %s to server group %s\n", l.Id, l.GroupId)
+	_, err = l.Client.ApplyFirewallPolicy(l.Id, l.GroupId)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (l *firewallPoliciesCommand) remove(pc *kingpin.ParseContext) error {
+	err := l.Configure()
+	if err != nil {
+		return err
+	}
+	l.Id, err = l.Client.firewallPolicyResolver().resolve(l.Id)
+	if err != nil {
+		return err
+	}
+	l.GroupId, err = l.Client.serverGroupResolver().resolve(l.GroupId)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Removing firewall policy %s from server group %s\n", l.Id, l.GroupId)
+	_, err = l.Client.RemoveFirewallPolicy(l.Id, l.GroupId)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func configureFirewallCommand(app *CLIApp) {
+	firewall := app.Command("firewall", "Manage firewall policies and rules")
+	configureFirewallPoliciesCommand(app, firewall)
+	configureFirewallRulesCommand(app, firewall)
+}
+
+func configureFirewallPoliciesCommand(app *CLIApp, parent *kingpin.CmdClause) {
+	cmd := firewallPoliciesCommand{CLIApp: app}
+	policies := parent.Command("policies", "Manage firewall policies")
+
+	list := policies.Command("list", "List firewall policies").
+		Default().Action(cmd.list)
+	app.listFlags(list)
+	list.Flag("fields", "Which fields to display").
+		Default(strings.Join(defaultFirewallPolicyListFields, ",")).
+		StringVar(&cmd.Fields)
+
+	show := policies.Command("show", "View details of a firewall policy").
+		Action(cmd.show)
+	show.Arg("identifier", "Identifier or name of firewall policy to show").
+		Required().StringVar(&cmd.Id)
+	show.Flag("fields", "Which fields to display").
+		Default(strings.Join(defaultFirewallPolicyShowFields, ",")).
+		StringVar(&cmd.Fields)
+
+	create := policies.Command("create", "Create a new firewall policy").
+		Action(cmd.create)
+	create.Flag("fields", "Which fields to display").
+		Default(strings.Join(defaultFirewallPolicyShowFields, ",")).
+		StringVar(&cmd.Fields)
+	create.Flag("name", "Name to give the new firewall policy").
+		Short('n').SetValue(&pStringValue{&cmd.Name})
+	create.Flag("description", "Description to give the new firewall policy").
+		Short('d').SetValue(&pStringValue{&cmd.Description})
+	create.Flag("group", "Identifier of server group to apply the new policy to").
+		Short('g').SetValue(&pStringValue{&cmd.Group})
+
+	update := policies.Command("update", "Update a firewall policy").
+		Action(cmd.update)
+	update.Arg("identifier", "Identifier or name of firewall policy to update").
+		Required().StringVar(&cmd.Id)
+	update.Flag("fields", "Which fields to display").
+		Default(strings.Join(defaultFirewallPolicyShowFields, ",")).
+		StringVar(&cmd.Fields)
+	update.Flag("name", "Set a new name for the firewall policy").
+		Short('n').SetValue(&pStringValue{&cmd.Name})
+	update.Flag("description", "Set a new description for the firewall policy").
+		Short('d').SetValue(&pStringValue{&cmd.Description})
+
+	destroy := policies.Command("destroy", "Destroy a firewall policy").
+		Action(cmd.destroy)
+	destroy.Arg("identifier", "Identifier or name of firewall policies to destroy").
+		Required().StringsVar(&cmd.IdList)
+
+	apply := policies.Command("apply", "Apply a firewall policy to a server group").
+		Action(cmd.apply)
+	apply.Arg("identifier", "Identifier or name of firewall policy to apply").
+		Required().StringVar(&cmd.Id)
+	apply.Arg("group_identifier", "Identifier or name of server group to apply the policy to").
+		Required().StringVar(&cmd.GroupId)
+
+	remove := policies.Command("remove", "Remove a firewall policy from a server group").
+		Action(cmd.remove)
+	remove.Arg("identifier", "Identifier or name of firewall policy to remove").
+		Required().StringVar(&cmd.Id)
+	remove.Arg("group_identifier", "Identifier or name of server group to remove the policy from").
+		Required().StringVar(&cmd.GroupId)
+}
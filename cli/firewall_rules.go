@@ -0,0 +1,206 @@
+package cli
+
+import (
+	"fmt"
+	"github.com/brightbox/gobrightbox"
+	"gopkg.in/alecthomas/kingpin.v2"
+	"strings"
+)
+
+var (
+	defaultFirewallRuleListFields = []string{"id", "protocol", "source", "source_port", "destination",
+		"destination_port", "icmp_type_name", "description"}
+	defaultFirewallRuleShowFields = []string{"id", "firewall_policy", "created_at", "protocol", "source",
+		"source_port", "destination", "destination_port", "icmp_type_name", "description"}
+)
+
+type firewallRulesCommand struct {
+	*CLIApp
+	Id              string
+	PolicyId        string
+	IdList          []string
+	Protocol        *string
+	Source          *string
+	SourcePort      *string
+	Destination     *string
+	DestinationPort *string
+	IcmpTypeName    *string
+	Description     *string
+	Fields          string
+}
+
+func firewallRuleFields(r *brightbox.FirewallRule) map[string]string {
+	return map[string]string{
+		"id":               r.Id,
+		"firewall_policy":  r.FirewallPolicy.Id,
+		"created":          r.CreatedAt.Format("2006-01-02"),
+		"created_at":       formatTime(&r.CreatedAt),
+		"protocol":         r.Protocol,
+		"source":           r.Source,
+		"source_port":      r.SourcePort,
+		"destination":      r.Destination,
+		"destination_port": r.DestinationPort,
+		"icmp_type_name":   r.IcmpTypeName,
+		"description":      r.Description,
+	}
+}
+
+func (l *firewallRulesCommand) ruleOptions() brightbox.FirewallRuleOptions {
+	return brightbox.FirewallRuleOptions{
+		Protocol:        l.Protocol,
+		Source:          l.Source,
+		SourcePort:      l.SourcePort,
+		Destination:     l.Destination,
+		DestinationPort: l.DestinationPort,
+		IcmpTypeName:    l.IcmpTypeName,
+		Description:     l.Description,
+	}
+}
+
+func (l *firewallRulesCommand) list(pc *kingpin.ParseContext) error {
+	err := l.Configure()
+	if err != nil {
+		return err
+	}
+	l.PolicyId, err = l.Client.firewallPolicyResolver().resolve(l.PolicyId)
+	if err != nil {
+		return err
+	}
+	out, err := l.rowOutput(l.Fields)
+	if err != nil {
+		return err
+	}
+	policy, err := l.Client.FirewallPolicy(l.PolicyId)
+	if err != nil {
+		return err
+	}
+	for _, r := range policy.Rules {
+		if err = out.Write(firewallRuleFields(&r), r); err != nil {
+			return err
+		}
+	}
+	return out.Flush()
+}
+
+func (l *firewallRulesCommand) create(pc *kingpin.ParseContext) error {
+	err := l.Configure()
+	if err != nil {
+		return err
+	}
+	l.PolicyId, err = l.Client.firewallPolicyResolver().resolve(l.PolicyId)
+	if err != nil {
+		return err
+	}
+	out, err := l.showOutput(l.Fields)
+	if err != nil {
+		return err
+	}
+	newRule := l.ruleOptions()
+	newRule.FirewallPolicy = l.PolicyId
+
+	rule, err := l.Client.CreateFirewallRule(&newRule)
+	if err != nil {
+		return err
+	}
+	if err = out.Write(firewallRuleFields(rule), rule); err != nil {
+		return err
+	}
+	return out.Flush()
+}
+
+func (l *firewallRulesCommand) update(pc *kingpin.ParseContext) error {
+	err := l.Configure()
+	if err != nil {
+		return err
+	}
+	out, err := l.showOutput(l.Fields)
+	if err != nil {
+		return err
+	}
+	updateRule := l.ruleOptions()
+	updateRule.Id = l.Id
+
+	rule, err := l.Client.UpdateFirewallRule(&updateRule)
+	if err != nil {
+		return err
+	}
+	if err = out.Write(firewallRuleFields(rule), rule); err != nil {
+		return err
+	}
+	return out.Flush()
+}
+
+func (l *firewallRulesCommand) destroy(pc *kingpin.ParseContext) error {
+	err := l.Configure()
+	if err != nil {
+		return err
+	}
+	returnError := false
+	for _, id := range l.IdList {
+		fmt.Printf("Destroying firewall rule %s\n", id)
+		err := l.Client.DestroyFirewallRule(id)
+		if err != nil {
+			l.Errorf("%s: %s", err.Error(), id)
+			returnError = true
+		}
+	}
+	if returnError {
+		return errGeneric
+	}
+	return nil
+}
+
+// Both create and update take the same set of rule flags
+func (l *firewallRulesCommand) ruleFlags(cmd *kingpin.CmdClause) {
+	cmd.Flag("protocol", "Protocol of the rule: tcp, udp, icmp or an IP protocol number").
+		Short('p').SetValue(&pStringValue{&l.Protocol})
+	cmd.Flag("source", "Source of traffic: any, a CIDR, or a server, group or load balancer identifier").
+		Short('s').SetValue(&pStringValue{&l.Source})
+	cmd.Flag("source-port", "Source port or comma separated list of ports").
+		SetValue(&pStringValue{&l.SourcePort})
+	cmd.Flag("destination", "Destination of traffic: any, a CIDR, or a server, group or load balancer identifier").
+		Short('d').SetValue(&pStringValue{&l.Destination})
+	cmd.Flag("destination-port", "Destination port or comma separated list of ports").
+		SetValue(&pStringValue{&l.DestinationPort})
+	cmd.Flag("icmp-type", "ICMP type name, e.g: echo-request").
+		SetValue(&pStringValue{&l.IcmpTypeName})
+	cmd.Flag("description", "Description of the rule").
+		SetValue(&pStringValue{&l.Description})
+}
+
+func configureFirewallRulesCommand(app *CLIApp, parent *kingpin.CmdClause) {
+	cmd := firewallRulesCommand{CLIApp: app}
+	rules := parent.Command("rules", "Manage firewall rules")
+
+	list := rules.Command("list", "List the rules of a firewall policy").
+		Default().Action(cmd.list)
+	list.Arg("policy_identifier", "Identifier or name of firewall policy to list the rules of").
+		Required().StringVar(&cmd.PolicyId)
+	app.listFlags(list)
+	list.Flag("fields", "Which fields to display").
+		Default(strings.Join(defaultFirewallRuleListFields, ",")).
+		StringVar(&cmd.Fields)
+
+	create := rules.Command("create", "Create a new firewall rule").
+		Action(cmd.create)
+	create.Arg("policy_identifier", "Identifier or name of firewall policy to add the rule to").
+		Required().StringVar(&cmd.PolicyId)
+	create.Flag("fields", "Which fields to display").
+		Default(strings.Join(defaultFirewallRuleShowFields, ",")).
+		StringVar(&cmd.Fields)
+	cmd.ruleFlags(create)
+
+	update := rules.Command("update", "Update a firewall rule").
+		Action(cmd.update)
+	update.Arg("identifier", "Identifier of firewall rule to update").
+		Required().StringVar(&cmd.Id)
+	update.Flag("fields", "Which fields to display").
+		Default(strings.Join(defaultFirewallRuleShowFields, ",")).
+		StringVar(&cmd.Fields)
+	cmd.ruleFlags(update)
+
+	destroy := rules.Command("destroy", "Destroy a firewall rule").
+		Action(cmd.destroy)
+	destroy.Arg("identifier", "Identifier of firewall rules to destroy").
+		Required().StringsVar(&cmd.IdList)
+}
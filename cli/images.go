@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"github.com/brightbox/gobrightbox"
 	"gopkg.in/alecthomas/kingpin.v2"
+	"os"
 	"sort"
 	"strings"
 )
@@ -17,6 +18,7 @@ var (
 
 type imagesCommand struct {
 	*CLIApp
+	waitOptions
 	Id      string
 	IdList  []string
 	ShowAll bool
@@ -109,6 +111,10 @@ func (l *imagesCommand) list(pc *kingpin.ParseContext) error {
 	if err != nil {
 		return err
 	}
+	out, err := l.rowOutput(l.Fields)
+	if err != nil {
+		return err
+	}
 
 	// Get the account id in parallel to everything else, we don't need it until
 	// later anyway.
@@ -117,9 +123,6 @@ func (l *imagesCommand) list(pc *kingpin.ParseContext) error {
 		achan <- l.accountId()
 	}()
 
-	out := new(RowFieldOutput)
-	out.Setup(strings.Split(l.Fields, ","))
-
 	images, err := l.Client.Images()
 	if err != nil {
 		return err
@@ -131,39 +134,40 @@ func (l *imagesCommand) list(pc *kingpin.ParseContext) error {
 	sort.Sort(sortedImages)
 
 	accountId := <-achan
-	out.SendHeader()
 	for _, i := range sortedImages {
 		if l.ShowAll == false {
 			if !i.Official && i.Owner != accountId {
 				continue
 			}
 		}
-		if err = out.Write(imageFields(&i)); err != nil {
+		if err = out.Write(imageFields(&i), i); err != nil {
 			return err
 		}
 	}
-	out.Flush()
-	return nil
+	return out.Flush()
 }
 
 func (l *imagesCommand) show(pc *kingpin.ParseContext) error {
-
 	err := l.Configure()
 	if err != nil {
 		return err
 	}
-	out := new(ShowFieldOutput)
-	out.Setup(strings.Split(l.Fields, ","))
-
+	l.Id, err = l.Client.imageResolver().resolve(l.Id)
+	if err != nil {
+		return err
+	}
+	out, err := l.showOutput(l.Fields)
+	if err != nil {
+		return err
+	}
 	i, err := l.Client.Image(l.Id)
 	if err != nil {
 		l.Fatalf(err.Error())
 	}
-	if err = out.Write(imageFields(i)); err != nil {
+	if err = out.Write(imageFields(i), i); err != nil {
 		return err
 	}
-	out.Flush()
-	return nil
+	return out.Flush()
 
 }
 
@@ -172,13 +176,30 @@ func (l *imagesCommand) destroy(pc *kingpin.ParseContext) error {
 	if err != nil {
 		return err
 	}
+	l.IdList, err = l.Client.imageResolver().resolveAll(l.IdList)
+	if err != nil {
+		return err
+	}
 	returnError := false
+	var destroyed []string
 	for _, id := range l.IdList {
 		fmt.Printf("Destroying image %s\n", id)
 		err := l.Client.DestroyImage(id)
 		if err != nil {
 			l.Errorf("%s: %s", err.Error(), id)
 			returnError = true
+			continue
+		}
+		destroyed = append(destroyed, id)
+	}
+	if l.Wait {
+		for _, id := range destroyed {
+			fmt.Fprintf(os.Stderr, "Waiting for image %s to be deleted\n", id)
+			err := waitForStatus("Image "+id, l.Timeout, l.Client.imageStatus(id), "deleted")
+			if err != nil {
+				l.Errorf("%s", err.Error())
+				returnError = true
+			}
 		}
 	}
 	if returnError {
@@ -191,6 +212,7 @@ func configureImagesCommand(app *CLIApp) {
 	cmd := imagesCommand{CLIApp: app}
 	images := app.Command("images", "Manage server images")
 	list := images.Command("list", "List server images").Default().Action(cmd.list)
+	app.listFlags(list)
 	list.Flag("fields", "Which fields to display").
 		Default(strings.Join(defaultImageListFields, ",")).
 		StringVar(&cmd.Fields)
@@ -199,8 +221,9 @@ func configureImagesCommand(app *CLIApp) {
 	show.Flag("fields", "Which fields to display").
 		Default(strings.Join(defaultImageShowFields, ",")).
 		StringVar(&cmd.Fields)
-	show.Arg("identifier", "Identifier of image to show").Required().StringVar(&cmd.Id)
+	show.Arg("identifier", "Identifier or name of image to show").Required().StringVar(&cmd.Id)
 	destroy := images.Command("destroy", "Destroy a server image").Action(cmd.destroy)
-	destroy.Arg("identifier", "Identifier of image to destroy").Required().StringsVar(&cmd.IdList)
+	destroy.Arg("identifier", "Identifier or name of image to destroy").Required().StringsVar(&cmd.IdList)
+	cmd.waitFlags(destroy, "deleted")
 
 }
@@ -0,0 +1,212 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/brightbox/gobrightbox"
+	"gopkg.in/alecthomas/kingpin.v2"
+	"os"
+	"regexp"
+	"sort"
+)
+
+type inventoryCommand struct {
+	*CLIApp
+	List bool
+	Host string
+}
+
+// ansibleInventory is an Ansible dynamic inventory, as printed by --list
+type ansibleInventory map[string]interface{}
+
+type ansibleGroup struct {
+	Hosts []string `json:"hosts"`
+}
+
+type ansibleMeta struct {
+	Hostvars map[string]map[string]string `json:"hostvars"`
+}
+
+var ansibleUnsafe = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// ansibleReserved are the names Ansible gives its own groups and the
+// inventory's host variables, which server groups mustn't overwrite
+var ansibleReserved = map[string]bool{
+	"all":       true,
+	"ungrouped": true,
+	"_meta":     true,
+}
+
+// ansibleGroupName makes a name usable as an Ansible group name, which may
+// only contain letters, digits and underscores. Names Ansible reserves are
+// prefixed with group_.
+func ansibleGroupName(name string) string {
+	name = ansibleUnsafe.ReplaceAllString(name, "_")
+	if ansibleReserved[name] {
+		return "group_" + name
+	}
+	return name
+}
+
+// inventoryHostnames names each server after its name, as ssh-config does,
+// falling back to its identifier for servers without a name or with a name
+// shared with another server.
+func inventoryHostnames(servers []brightbox.Server) map[string]string {
+	counts := make(map[string]int)
+	for _, s := range servers {
+		counts[sshHostAlias(s.Name)]++
+	}
+	hostnames := make(map[string]string)
+	for _, s := range servers {
+		alias := sshHostAlias(s.Name)
+		if alias == "" || counts[alias] > 1 {
+			alias = s.Id
+		}
+		hostnames[s.Id] = alias
+	}
+	return hostnames
+}
+
+// ansibleZoneGroup and ansibleTypeGroup are the groups for a server's zone
+// and type, or "" if it doesn't have one
+func ansibleZoneGroup(s *brightbox.Server) string {
+	if s.Zone.Handle == "" {
+		return ""
+	}
+	return "zone_" + ansibleGroupName(s.Zone.Handle)
+}
+
+func ansibleTypeGroup(s *brightbox.Server) string {
+	if s.ServerType.Handle == "" {
+		return ""
+	}
+	return "type_" + ansibleGroupName(s.ServerType.Handle)
+}
+
+// ansibleGroupNames names the Ansible group for each server group after its
+// name, falling back to its identifier for server groups without a name, or
+// with a name that would be the same as another server group's or a zone or
+// type group's, so their hosts aren't merged.
+func ansibleGroupNames(servers []brightbox.Server) map[string]string {
+	counts := make(map[string]int)
+	taken := make(map[string]bool)
+	seen := make(map[string]bool)
+	for i := range servers {
+		s := &servers[i]
+		taken[ansibleZoneGroup(s)] = true
+		taken[ansibleTypeGroup(s)] = true
+		for _, g := range s.ServerGroups {
+			if !seen[g.Id] {
+				seen[g.Id] = true
+				counts[ansibleGroupName(g.Name)]++
+			}
+		}
+	}
+	names := make(map[string]string)
+	for _, s := range servers {
+		for _, g := range s.ServerGroups {
+			name := ansibleGroupName(g.Name)
+			if name == "" || counts[name] > 1 || taken[name] {
+				name = ansibleGroupName(g.Id)
+			}
+			names[g.Id] = name
+		}
+	}
+	return names
+}
+
+// ansibleHostvars are the variables of a server in the inventory: its fields,
+// prefixed with brightbox_, and the address and user Ansible should connect
+// with.
+func (c *Client) ansibleHostvars(s *brightbox.Server, usernames map[string]string) map[string]string {
+	vars := make(map[string]string)
+	for k, v := range serverFields(*s) {
+		vars["brightbox_"+k] = v
+	}
+	vars["ansible_host"] = serverSSHAddress(s)
+	if user := c.imageUsername(s, usernames); user != "" {
+		vars["ansible_user"] = user
+	}
+	return vars
+}
+
+// buildAnsibleInventory builds the inventory of all active servers. Server
+// groups become Ansible groups, named as ansibleGroupNames does, and each
+// zone and server type becomes a group too, prefixed with zone_ and type_.
+func (c *Client) buildAnsibleInventory() (ansibleInventory, error) {
+	all, err := c.Servers()
+	if err != nil {
+		return nil, err
+	}
+	var servers []brightbox.Server
+	for _, s := range all {
+		if s.Status == "active" {
+			servers = append(servers, s)
+		}
+	}
+	hostnames := inventoryHostnames(servers)
+	groupNames := ansibleGroupNames(servers)
+
+	groups := make(map[string][]string)
+	meta := ansibleMeta{Hostvars: make(map[string]map[string]string)}
+	usernames := make(map[string]string)
+	for i := range servers {
+		s := &servers[i]
+		host := hostnames[s.Id]
+		meta.Hostvars[host] = c.ansibleHostvars(s, usernames)
+		for _, g := range s.ServerGroups {
+			groups[groupNames[g.Id]] = append(groups[groupNames[g.Id]], host)
+		}
+		if zone := ansibleZoneGroup(s); zone != "" {
+			groups[zone] = append(groups[zone], host)
+		}
+		if stype := ansibleTypeGroup(s); stype != "" {
+			groups[stype] = append(groups[stype], host)
+		}
+	}
+
+	inventory := make(ansibleInventory)
+	for name, hosts := range groups {
+		sort.Strings(hosts)
+		inventory[name] = ansibleGroup{Hosts: hosts}
+	}
+	inventory["_meta"] = meta
+	return inventory, nil
+}
+
+func (l *inventoryCommand) ansible(pc *kingpin.ParseContext) error {
+	if l.List == (l.Host != "") {
+		return fmt.Errorf("Exactly one of --list and --host must be given")
+	}
+	err := l.Configure()
+	if err != nil {
+		return err
+	}
+	inventory, err := l.Client.buildAnsibleInventory()
+	if err != nil {
+		return err
+	}
+	var output interface{} = inventory
+	if l.Host != "" {
+		vars, ok := inventory["_meta"].(ansibleMeta).Hostvars[l.Host]
+		if !ok {
+			vars = map[string]string{}
+		}
+		output = vars
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(output)
+}
+
+func configureInventoryCommand(app *CLIApp) {
+	cmd := inventoryCommand{CLIApp: app}
+	inventory := app.Command("inventory", "Generate inventories of cloud servers for other tools")
+
+	ansible := inventory.Command("ansible", "Ansible dynamic inventory of active cloud servers, to be run by an inventory script such as contrib/ansible_inventory.sh").
+		Action(cmd.ansible)
+	ansible.Flag("list", "List all hosts and groups").
+		BoolVar(&cmd.List)
+	ansible.Flag("host", "Show the variables of one host").
+		PlaceHolder("NAME").StringVar(&cmd.Host)
+}
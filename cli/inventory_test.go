@@ -0,0 +1,65 @@
+package cli
+
+import (
+	"github.com/brightbox/gobrightbox"
+	"reflect"
+	"testing"
+)
+
+func TestAnsibleGroupName(t *testing.T) {
+	tests := map[string]string{
+		"web":           "web",
+		"web servers":   "web_servers",
+		"gb1-a":         "gb1_a",
+		"db.prod/eu":    "db_prod_eu",
+		"all":           "group_all",
+		"ungrouped":     "group_ungrouped",
+		"_meta":         "group__meta",
+		"-meta":         "group__meta",
+		"all-the-hosts": "all_the_hosts",
+	}
+	for name, want := range tests {
+		if got := ansibleGroupName(name); got != want {
+			t.Errorf("ansibleGroupName(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestAnsibleGroupNames(t *testing.T) {
+	group := func(id, name string) brightbox.ServerGroup {
+		var g brightbox.ServerGroup
+		g.Id, g.Name = id, name
+		return g
+	}
+	var web, db brightbox.Server
+	web.Zone.Handle, web.ServerType.Handle = "gb1-a", "small"
+	web.ServerGroups = []brightbox.ServerGroup{
+		group("grp-web1a", "web-1"),
+		group("grp-web1b", "web_1"),
+		group("grp-zonea", "zone_gb1_a"),
+		group("grp-typea", "type_small"),
+		group("grp-unnam", ""),
+		group("grp-appaa", "app"),
+	}
+	db.Zone.Handle, db.ServerType.Handle = "gb1-b", "large"
+	db.ServerGroups = []brightbox.ServerGroup{
+		group("grp-dbaaa", "db"),
+		group("grp-dbbbb", "db"),
+		group("grp-appaa", "app"),
+		group("grp-zoneb", "zone_gb1_c"),
+	}
+	want := map[string]string{
+		"grp-web1a": "grp_web1a",
+		"grp-web1b": "grp_web1b",
+		"grp-zonea": "grp_zonea",
+		"grp-typea": "grp_typea",
+		"grp-unnam": "grp_unnam",
+		"grp-appaa": "app",
+		"grp-dbaaa": "grp_dbaaa",
+		"grp-dbbbb": "grp_dbbbb",
+		"grp-zoneb": "zone_gb1_c",
+	}
+	if got := ansibleGroupNames([]brightbox.Server{web, db}); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,199 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// jsonPath is a parsed JSONPath template, in the style used by kubectl: plain
+// text with expressions such as {.interfaces[*].ipv4_address} in braces.
+//
+// Only a subset of JSONPath is supported: child keys (.key or ['key']), array
+// indexes ([0], [-1]) and wildcards ([*] or .*). Keys are matched exactly or,
+// failing that, case insensitively.
+type jsonPath struct {
+	parts []jsonPathPart
+}
+
+// A part of a template is either literal text or an expression
+type jsonPathPart struct {
+	text  string
+	steps []jsonPathStep
+}
+
+type jsonPathStep struct {
+	key      string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+func parseJSONPath(tmpl string) (*jsonPath, error) {
+	jp := new(jsonPath)
+	for len(tmpl) > 0 {
+		start := strings.Index(tmpl, "{")
+		if start < 0 {
+			jp.parts = append(jp.parts, jsonPathPart{text: tmpl})
+			break
+		}
+		if start > 0 {
+			jp.parts = append(jp.parts, jsonPathPart{text: tmpl[:start]})
+		}
+		end := strings.Index(tmpl[start:], "}")
+		if end < 0 {
+			return nil, fmt.Errorf("Unclosed expression in JSONPath '%s'", tmpl)
+		}
+		steps, err := parseJSONPathExpression(tmpl[start+1 : start+end])
+		if err != nil {
+			return nil, err
+		}
+		jp.parts = append(jp.parts, jsonPathPart{steps: steps})
+		tmpl = tmpl[start+end+1:]
+	}
+	return jp, nil
+}
+
+func parseJSONPathExpression(expr string) ([]jsonPathStep, error) {
+	var steps []jsonPathStep
+	e := strings.TrimPrefix(strings.TrimSpace(expr), "$")
+	for len(e) > 0 {
+		switch e[0] {
+		case '.':
+			e = e[1:]
+			n := strings.IndexAny(e, ".[")
+			if n < 0 {
+				n = len(e)
+			}
+			key := e[:n]
+			e = e[n:]
+			if key == "" {
+				if len(e) > 0 && e[0] == '.' {
+					return nil, fmt.Errorf("Recursive descent is not supported in JSONPath '%s'", expr)
+				}
+				continue
+			}
+			if key == "*" {
+				steps = append(steps, jsonPathStep{wildcard: true})
+			} else {
+				steps = append(steps, jsonPathStep{key: key})
+			}
+		case '[':
+			n := strings.Index(e, "]")
+			if n < 0 {
+				return nil, fmt.Errorf("Unclosed subscript in JSONPath '%s'", expr)
+			}
+			sub := strings.TrimSpace(e[1:n])
+			e = e[n+1:]
+			if sub == "*" {
+				steps = append(steps, jsonPathStep{wildcard: true})
+			} else if len(sub) >= 2 && (sub[0] == '\'' || sub[0] == '"') && sub[len(sub)-1] == sub[0] {
+				steps = append(steps, jsonPathStep{key: sub[1 : len(sub)-1]})
+			} else {
+				i, err := strconv.Atoi(sub)
+				if err != nil {
+					return nil, fmt.Errorf("Unsupported subscript [%s] in JSONPath '%s'", sub, expr)
+				}
+				steps = append(steps, jsonPathStep{index: i, isIndex: true})
+			}
+		default:
+			return nil, fmt.Errorf("Unexpected '%c' in JSONPath '%s'", e[0], expr)
+		}
+	}
+	return steps, nil
+}
+
+// Execute evaluates the template against data, which should be made up of
+// plain maps and slices as decoded from json. Where an expression matches
+// several values they are separated by spaces.
+func (jp *jsonPath) Execute(data interface{}) (string, error) {
+	var b strings.Builder
+	for _, p := range jp.parts {
+		if p.steps == nil {
+			b.WriteString(p.text)
+			continue
+		}
+		values := []interface{}{data}
+		for _, s := range p.steps {
+			values = s.apply(values)
+		}
+		strs := make([]string, len(values))
+		for i, v := range values {
+			s, err := formatJSONPathValue(v)
+			if err != nil {
+				return "", err
+			}
+			strs[i] = s
+		}
+		b.WriteString(strings.Join(strs, " "))
+	}
+	return b.String(), nil
+}
+
+func (s jsonPathStep) apply(values []interface{}) []interface{} {
+	var results []interface{}
+	for _, v := range values {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			if s.wildcard {
+				keys := make([]string, 0, len(v))
+				for k := range v {
+					keys = append(keys, k)
+				}
+				sort.Strings(keys)
+				for _, k := range keys {
+					results = append(results, v[k])
+				}
+			} else if !s.isIndex {
+				if child, ok := lookupJSONKey(v, s.key); ok {
+					results = append(results, child)
+				}
+			}
+		case []interface{}:
+			if s.wildcard {
+				results = append(results, v...)
+			} else if s.isIndex {
+				i := s.index
+				if i < 0 {
+					i += len(v)
+				}
+				if i >= 0 && i < len(v) {
+					results = append(results, v[i])
+				}
+			}
+		}
+	}
+	return results
+}
+
+func lookupJSONKey(m map[string]interface{}, key string) (interface{}, bool) {
+	if v, ok := m[key]; ok {
+		return v, true
+	}
+	for k, v := range m {
+		if strings.EqualFold(k, key) {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+func formatJSONPathValue(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case bool:
+		return formatBool(v), nil
+	}
+	j, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(j), nil
+}
@@ -39,3 +39,21 @@ func (ps *pBoolValue) String() string {
 		return fmt.Sprintf("%v", false)
 	}
 }
+
+type pIntValue struct {
+	Target **int
+}
+
+func (ps *pIntValue) Set(s string) error {
+	v, err := strconv.Atoi(s)
+	*ps.Target = &v
+	return err
+}
+
+func (ps *pIntValue) String() string {
+	if ps.Target != nil && *ps.Target != nil {
+		return fmt.Sprintf("%d", **ps.Target)
+	} else {
+		return ""
+	}
+}
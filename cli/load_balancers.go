@@ -0,0 +1,430 @@
+package cli
+
+import (
+	"fmt"
+	"github.com/brightbox/gobrightbox"
+	"gopkg.in/alecthomas/kingpin.v2"
+	"strconv"
+	"strings"
+)
+
+var (
+	defaultLoadBalancerListFields = []string{"id", "status", "created", "cloud_ips", "nodes", "name"}
+	defaultLoadBalancerShowFields = []string{"id", "status", "locked", "name", "created_at", "deleted_at",
+		"policy", "buffer_size", "listeners", "healthcheck", "https_redirect", "cloud_ips", "nodes"}
+)
+
+type loadBalancersCommand struct {
+	*CLIApp
+	Id                       string
+	IdList                   []string
+	Name                     *string
+	Nodes                    *string
+	Listeners                *string
+	Policy                   *string
+	BufferSize               *int
+	HealthcheckType          *string
+	HealthcheckPort          *int
+	HealthcheckRequest       *string
+	HealthcheckInterval      *int
+	HealthcheckTimeout       *int
+	HealthcheckThresholdUp   *int
+	HealthcheckThresholdDown *int
+	Fields                   string
+}
+
+func formatLoadBalancerListeners(ls []brightbox.LoadBalancerListener) string {
+	fls := make([]string, len(ls))
+	for i, l := range ls {
+		fls[i] = fmt.Sprintf("%d:%d:%s:%d", l.In, l.Out, l.Protocol, l.Timeout)
+	}
+	return strings.Join(fls, ",")
+}
+
+func formatLoadBalancerHealthcheck(hc brightbox.LoadBalancerHealthcheck) string {
+	s := fmt.Sprintf("%s:%d", hc.Type, hc.Port)
+	if hc.Request != "" {
+		s += ":" + hc.Request
+	}
+	return s
+}
+
+// parseLoadBalancerListeners parses listeners in the in:out:protocol:timeout
+// format displayed by formatLoadBalancerListeners. The timeout is optional.
+func parseLoadBalancerListeners(s string) ([]brightbox.LoadBalancerListener, error) {
+	var listeners []brightbox.LoadBalancerListener
+	for _, ls := range strings.Split(s, ",") {
+		if ls == "" {
+			continue
+		}
+		toks := strings.Split(ls, ":")
+		if len(toks) < 3 || len(toks) > 4 {
+			return nil, fmt.Errorf("Invalid listener '%s', expected in:out:protocol[:timeout]", ls)
+		}
+		in, err := strconv.Atoi(toks[0])
+		if err != nil {
+			return nil, fmt.Errorf("Invalid incoming port in listener '%s'", ls)
+		}
+		out, err := strconv.Atoi(toks[1])
+		if err != nil {
+			return nil, fmt.Errorf("Invalid outgoing port in listener '%s'", ls)
+		}
+		listener := brightbox.LoadBalancerListener{In: in, Out: out, Protocol: toks[2]}
+		if len(toks) == 4 {
+			listener.Timeout, err = strconv.Atoi(toks[3])
+			if err != nil {
+				return nil, fmt.Errorf("Invalid timeout in listener '%s'", ls)
+			}
+		}
+		listeners = append(listeners, listener)
+	}
+	return listeners, nil
+}
+
+func loadBalancerNodes(ids []string) []brightbox.LoadBalancerNode {
+	nodes := make([]brightbox.LoadBalancerNode, 0, len(ids))
+	for _, id := range ids {
+		if id != "" {
+			nodes = append(nodes, brightbox.LoadBalancerNode{Node: id})
+		}
+	}
+	return nodes
+}
+
+func loadBalancerFields(lb *brightbox.LoadBalancer) map[string]string {
+	return map[string]string{
+		"id":             lb.Id,
+		"status":         lb.Status,
+		"locked":         formatBool(lb.Locked),
+		"name":           lb.Name,
+		"created":        lb.CreatedAt.Format("2006-01-02"),
+		"created_at":     formatTime(lb.CreatedAt),
+		"deleted_at":     formatTime(lb.DeletedAt),
+		"policy":         lb.Policy,
+		"buffer_size":    formatInt(lb.BufferSize),
+		"listeners":      formatLoadBalancerListeners(lb.Listeners),
+		"healthcheck":    formatLoadBalancerHealthcheck(lb.Healthcheck),
+		"https_redirect": formatBool(lb.HttpsRedirect),
+		"cloud_ips":      collectById(lb.CloudIPs),
+		"public_ips":     collectByField(lb.CloudIPs, "PublicIP"),
+		"nodes":          collectById(lb.Nodes),
+		"node_count":     formatInt(len(lb.Nodes)),
+	}
+}
+
+// Apply any healthcheck flags on top of the given healthcheck. Returns nil if
+// no healthcheck flags were given.
+func (l *loadBalancersCommand) healthcheck(hc brightbox.LoadBalancerHealthcheck) *brightbox.LoadBalancerHealthcheck {
+	changed := false
+	if l.HealthcheckType != nil {
+		hc.Type = *l.HealthcheckType
+		changed = true
+	}
+	if l.HealthcheckPort != nil {
+		hc.Port = *l.HealthcheckPort
+		changed = true
+	}
+	if l.HealthcheckRequest != nil {
+		hc.Request = *l.HealthcheckRequest
+		changed = true
+	}
+	if l.HealthcheckInterval != nil {
+		hc.Interval = *l.HealthcheckInterval
+		changed = true
+	}
+	if l.HealthcheckTimeout != nil {
+		hc.Timeout = *l.HealthcheckTimeout
+		changed = true
+	}
+	if l.HealthcheckThresholdUp != nil {
+		hc.ThresholdUp = *l.HealthcheckThresholdUp
+		changed = true
+	}
+	if l.HealthcheckThresholdDown != nil {
+		hc.ThresholdDown = *l.HealthcheckThresholdDown
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	return &hc
+}
+
+func (l *loadBalancersCommand) list(pc *kingpin.ParseContext) error {
+	err := l.Configure()
+	if err != nil {
+		return err
+	}
+	out, err := l.rowOutput(l.Fields)
+	if err != nil {
+		return err
+	}
+	lbs, err := l.Client.LoadBalancers()
+	if err != nil {
+		return err
+	}
+	for _, lb := range lbs {
+		if err = out.Write(loadBalancerFields(&lb), lb); err != nil {
+			return err
+		}
+	}
+	return out.Flush()
+}
+
+func (l *loadBalancersCommand) show(pc *kingpin.ParseContext) error {
+	err := l.Configure()
+	if err != nil {
+		return err
+	}
+	l.Id, err = l.Client.loadBalancerResolver().resolve(l.Id)
+	if err != nil {
+		return err
+	}
+	out, err := l.showOutput(l.Fields)
+	if err != nil {
+		return err
+	}
+	lb, err := l.Client.LoadBalancer(l.Id)
+	if err != nil {
+		l.Fatalf(err.Error())
+	}
+	if err = out.Write(loadBalancerFields(lb), lb); err != nil {
+		return err
+	}
+	return out.Flush()
+}
+
+func (l *loadBalancersCommand) create(pc *kingpin.ParseContext) error {
+	err := l.Configure()
+	if err != nil {
+		return err
+	}
+	out, err := l.showOutput(l.Fields)
+	if err != nil {
+		return err
+	}
+	newLB := brightbox.LoadBalancerOptions{
+		Name:       l.Name,
+		Policy:     l.Policy,
+		BufferSize: l.BufferSize,
+	}
+	if l.Nodes != nil {
+		nodes, err := l.Client.serverResolver().resolveAll(strings.Split(*l.Nodes, ","))
+		if err != nil {
+			return err
+		}
+		newLB.Nodes = loadBalancerNodes(nodes)
+	}
+	if l.Listeners != nil {
+		newLB.Listeners, err = parseLoadBalancerListeners(*l.Listeners)
+		if err != nil {
+			return err
+		}
+	}
+	newLB.Healthcheck = l.healthcheck(brightbox.LoadBalancerHealthcheck{})
+
+	lb, err := l.Client.CreateLoadBalancer(&newLB)
+	if err != nil {
+		return err
+	}
+	if err = out.Write(loadBalancerFields(lb), lb); err != nil {
+		return err
+	}
+	return out.Flush()
+}
+
+func (l *loadBalancersCommand) update(pc *kingpin.ParseContext) error {
+	err := l.Configure()
+	if err != nil {
+		return err
+	}
+	l.Id, err = l.Client.loadBalancerResolver().resolve(l.Id)
+	if err != nil {
+		return err
+	}
+	out, err := l.showOutput(l.Fields)
+	if err != nil {
+		return err
+	}
+	updateLB := brightbox.LoadBalancerOptions{
+		Id:         l.Id,
+		Name:       l.Name,
+		Policy:     l.Policy,
+		BufferSize: l.BufferSize,
+	}
+	if l.Listeners != nil {
+		updateLB.Listeners, err = parseLoadBalancerListeners(*l.Listeners)
+		if err != nil {
+			return err
+		}
+	}
+	// The API replaces the whole healthcheck, so merge any changes into the
+	// existing one
+	if hc := l.healthcheck(brightbox.LoadBalancerHealthcheck{}); hc != nil {
+		current, err := l.Client.LoadBalancer(l.Id)
+		if err != nil {
+			return err
+		}
+		updateLB.Healthcheck = l.healthcheck(current.Healthcheck)
+	}
+
+	lb, err := l.Client.UpdateLoadBalancer(&updateLB)
+	if err != nil {
+		return err
+	}
+	if err = out.Write(loadBalancerFields(lb), lb); err != nil {
+		return err
+	}
+	return out.Flush()
+}
+
+func (l *loadBalancersCommand) destroy(pc *kingpin.ParseContext) error {
+	err := l.Configure()
+	if err != nil {
+		return err
+	}
+	l.IdList, err = l.Client.loadBalancerResolver().resolveAll(l.IdList)
+	if err != nil {
+		return err
+	}
+	returnError := false
+	for _, id := range l.IdList {
+		fmt.Printf("Destroying load balancer %s\n", id)
+		err := l.Client.DestroyLoadBalancer(id)
+		if err != nil {
+			l.Errorf("%s: %s", err.Error(), id)
+			returnError = true
+		}
+	}
+	if returnError {
+		return errGeneric
+	}
+	return nil
+}
+
+func (l *loadBalancersCommand) addNodes(pc *kingpin.ParseContext) error {
+	err := l.Configure()
+	if err != nil {
+		return err
+	}
+	l.Id, err = l.Client.loadBalancerResolver().resolve(l.Id)
+	if err != nil {
+		return err
+	}
+	l.IdList, err = l.Client.serverResolver().resolveAll(l.IdList)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Adding nodes %s to load balancer %s\n", strings.Join(l.IdList, ", "), l.Id)
+	_, err = l.Client.AddNodesToLoadBalancer(l.Id, loadBalancerNodes(l.IdList))
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (l *loadBalancersCommand) removeNodes(pc *kingpin.ParseContext) error {
+	err := l.Configure()
+	if err != nil {
+		return err
+	}
+	l.Id, err = l.Client.loadBalancerResolver().resolve(l.Id)
+	if err != nil {
+		return err
+	}
+	l.IdList, err = l.Client.serverResolver().resolveAll(l.IdList)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Removing nodes %s from load balancer %s\n", strings.Join(l.IdList, ", "), l.Id)
+	_, err = l.Client.RemoveNodesFromLoadBalancer(l.Id, loadBalancerNodes(l.IdList))
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Both create and update take the same set of configuration flags
+func (l *loadBalancersCommand) configFlags(cmd *kingpin.CmdClause) {
+	cmd.Flag("listeners", "Listeners in the format in:out:protocol[:timeout]. Comma separate multiple listeners.").
+		Short('l').PlaceHolder("80:80:http:50000").SetValue(&pStringValue{&l.Listeners})
+	cmd.Flag("policy", "Balancing policy: least-connections, round-robin or source-address").
+		Short('p').SetValue(&pStringValue{&l.Policy})
+	cmd.Flag("buffer-size", "Buffer size in bytes").
+		SetValue(&pIntValue{&l.BufferSize})
+	cmd.Flag("hc-type", "Healthcheck type: tcp or http").
+		SetValue(&pStringValue{&l.HealthcheckType})
+	cmd.Flag("hc-port", "Healthcheck port").
+		SetValue(&pIntValue{&l.HealthcheckPort})
+	cmd.Flag("hc-request", "Healthcheck request path for http healthchecks").
+		SetValue(&pStringValue{&l.HealthcheckRequest})
+	cmd.Flag("hc-interval", "Healthcheck interval in milliseconds").
+		SetValue(&pIntValue{&l.HealthcheckInterval})
+	cmd.Flag("hc-timeout", "Healthcheck timeout in milliseconds").
+		SetValue(&pIntValue{&l.HealthcheckTimeout})
+	cmd.Flag("hc-threshold-up", "Number of successful healthchecks before a node is considered up").
+		SetValue(&pIntValue{&l.HealthcheckThresholdUp})
+	cmd.Flag("hc-threshold-down", "Number of failed healthchecks before a node is considered down").
+		SetValue(&pIntValue{&l.HealthcheckThresholdDown})
+}
+
+func configureLoadBalancersCommand(app *CLIApp) {
+	cmd := loadBalancersCommand{CLIApp: app}
+	lbs := app.Command("lbs", "Manage load balancers")
+
+	list := lbs.Command("list", "List load balancers").
+		Default().Action(cmd.list)
+	app.listFlags(list)
+	list.Flag("fields", "Which fields to display").
+		Default(strings.Join(defaultLoadBalancerListFields, ",")).
+		StringVar(&cmd.Fields)
+
+	show := lbs.Command("show", "View details of a load balancer").
+		Action(cmd.show)
+	show.Arg("identifier", "Identifier or name of load balancer to show").
+		Required().StringVar(&cmd.Id)
+	show.Flag("fields", "Which fields to display").
+		Default(strings.Join(defaultLoadBalancerShowFields, ",")).
+		StringVar(&cmd.Fields)
+
+	create := lbs.Command("create", "Create a new load balancer").
+		Action(cmd.create)
+	create.Flag("fields", "Which fields to display").
+		Default(strings.Join(defaultLoadBalancerShowFields, ",")).
+		StringVar(&cmd.Fields)
+	create.Flag("name", "Name to give the new load balancer").
+		Short('n').SetValue(&pStringValue{&cmd.Name})
+	create.Flag("nodes", "Identifiers of servers to balance across. Comma separate multiple servers.").
+		SetValue(&pStringValue{&cmd.Nodes})
+	cmd.configFlags(create)
+
+	update := lbs.Command("update", "Update a load balancer").
+		Action(cmd.update)
+	update.Arg("identifier", "Identifier or name of load balancer to update").
+		Required().StringVar(&cmd.Id)
+	update.Flag("fields", "Which fields to display").
+		Default(strings.Join(defaultLoadBalancerShowFields, ",")).
+		StringVar(&cmd.Fields)
+	update.Flag("name", "Set a new name for the load balancer").
+		Short('n').SetValue(&pStringValue{&cmd.Name})
+	cmd.configFlags(update)
+
+	destroy := lbs.Command("destroy", "Destroy a load balancer").
+		Action(cmd.destroy)
+	destroy.Arg("identifier", "Identifier or name of load balancers to destroy").
+		Required().StringsVar(&cmd.IdList)
+
+	add := lbs.Command("add_nodes", "Add servers to a load balancer").
+		Action(cmd.addNodes)
+	add.Arg("lb_identifier", "Identifier or name of load balancer to add the nodes to").
+		Required().StringVar(&cmd.Id)
+	add.Arg("server_identifiers", "Identifiers or names of servers to add to the load balancer").
+		Required().StringsVar(&cmd.IdList)
+
+	rem := lbs.Command("remove_nodes", "Remove servers from a load balancer").
+		Action(cmd.removeNodes)
+	rem.Arg("lb_identifier", "Identifier or name of load balancer to remove the nodes from").
+		Required().StringVar(&cmd.Id)
+	rem.Arg("server_identifiers", "Identifiers or names of servers to remove from the load balancer").
+		Required().StringsVar(&cmd.IdList)
+}
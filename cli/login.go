@@ -97,6 +97,7 @@ func (l *loginCommand) login(pc *kingpin.ParseContext) error {
 		client.DefaultAccount = l.DefaultAccount
 	}
 
+	client.transport = l.transport
 	oc := client.oauthConfig()
 	var token *oauth2.Token
 	switch oc := oc.(type) {
@@ -109,7 +110,7 @@ func (l *loginCommand) login(pc *kingpin.ParseContext) error {
 		if string(password) == "" {
 			l.Fatalf("Password not provided.")
 		}
-		token, err = oc.PasswordCredentialsToken(oauth2.NoContext, client.Username, string(password))
+		token, err = oc.PasswordCredentialsToken(client.httpContext(), client.Username, string(password))
 		if err != nil {
 			l.Fatalf("%s", err)
 		}
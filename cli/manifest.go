@@ -0,0 +1,127 @@
+package cli
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// manifest describes the server groups, servers and Cloud IPs an account
+// should have. Resources are matched to existing ones by name, and refer to
+// each other by name too. It is read from YAML, or JSON, which is valid YAML.
+//
+// Optional settings left out of a manifest are left alone on existing
+// resources. The label is a name prefix: with --prune, resources whose names
+// start with it are destroyed if the manifest doesn't list them.
+type manifest struct {
+	Label        string                `yaml:"label,omitempty" json:"label,omitempty"`
+	ServerGroups []manifestServerGroup `yaml:"server_groups,omitempty" json:"server_groups,omitempty"`
+	Servers      []manifestServer      `yaml:"servers,omitempty" json:"servers,omitempty"`
+	CloudIPs     []manifestCloudIP     `yaml:"cloud_ips,omitempty" json:"cloud_ips,omitempty"`
+	Images       []manifestImage       `yaml:"images,omitempty" json:"images,omitempty"`
+}
+
+type manifestServerGroup struct {
+	Name        string  `yaml:"name" json:"name"`
+	Description *string `yaml:"description,omitempty" json:"description,omitempty"`
+}
+
+// Servers can't be rebuilt in place, so the image, type and zone are only
+// used when creating them, as is the user data, which the API doesn't list.
+// Groups are server group names, or identifiers.
+type manifestServer struct {
+	Name              string   `yaml:"name" json:"name"`
+	Image             string   `yaml:"image" json:"image"`
+	Type              string   `yaml:"type,omitempty" json:"type,omitempty"`
+	Zone              string   `yaml:"zone,omitempty" json:"zone,omitempty"`
+	Groups            []string `yaml:"groups,omitempty" json:"groups,omitempty"`
+	UserData          *string  `yaml:"user_data,omitempty" json:"user_data,omitempty"`
+	CompatibilityMode *bool    `yaml:"compatibility_mode,omitempty" json:"compatibility_mode,omitempty"`
+}
+
+// Map is the name of the server or server group to map the Cloud IP to, or
+// the identifier of any Cloud IP destination. An empty Map unmaps it.
+type manifestCloudIP struct {
+	Name            string  `yaml:"name" json:"name"`
+	ReverseDns      *string `yaml:"reverse_dns,omitempty" json:"reverse_dns,omitempty"`
+	PortTranslators *string `yaml:"port_translators,omitempty" json:"port_translators,omitempty"`
+	Map             *string `yaml:"map,omitempty" json:"map,omitempty"`
+}
+
+// Images are only listed for reference, since apply can't create them. Plans
+// warn about any that no longer exist.
+type manifestImage struct {
+	Id          string `yaml:"id" json:"id"`
+	Name        string `yaml:"name,omitempty" json:"name,omitempty"`
+	Description string `yaml:"description,omitempty" json:"description,omitempty"`
+	Arch        string `yaml:"arch,omitempty" json:"arch,omitempty"`
+	Username    string `yaml:"username,omitempty" json:"username,omitempty"`
+}
+
+// readManifest reads and checks a manifest from a file, or from stdin if the
+// filename is -
+func readManifest(filename string) (*manifest, error) {
+	var data []byte
+	var err error
+	if filename == "-" {
+		data, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		data, err = ioutil.ReadFile(filename)
+	}
+	if err != nil {
+		return nil, err
+	}
+	m := new(manifest)
+	if err = yaml.UnmarshalStrict(data, m); err != nil {
+		return nil, fmt.Errorf("%s: %s", filename, err.Error())
+	}
+	if err = m.check(); err != nil {
+		return nil, fmt.Errorf("%s: %s", filename, err.Error())
+	}
+	return m, nil
+}
+
+func (m *manifest) check() error {
+	names := make(map[string]bool)
+	checkName := func(kind, name string) error {
+		if strings.TrimSpace(name) == "" {
+			return fmt.Errorf("Every %s needs a name", kind)
+		}
+		if names[kind+"/"+name] {
+			return fmt.Errorf("More than one %s named '%s'", kind, name)
+		}
+		names[kind+"/"+name] = true
+		return nil
+	}
+	for _, g := range m.ServerGroups {
+		if err := checkName("server group", g.Name); err != nil {
+			return err
+		}
+	}
+	for _, s := range m.Servers {
+		if err := checkName("server", s.Name); err != nil {
+			return err
+		}
+		if s.Image == "" {
+			return fmt.Errorf("Server '%s' needs an image", s.Name)
+		}
+	}
+	for _, cip := range m.CloudIPs {
+		if err := checkName("Cloud IP", cip.Name); err != nil {
+			return err
+		}
+		if cip.PortTranslators != nil {
+			if _, err := parsePortTranslators(*cip.PortTranslators); err != nil {
+				return fmt.Errorf("Cloud IP '%s': %s", cip.Name, err.Error())
+			}
+		}
+	}
+	for _, img := range m.Images {
+		if img.Id == "" {
+			return fmt.Errorf("Image '%s' needs an id", img.Name)
+		}
+	}
+	return nil
+}
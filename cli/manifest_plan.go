@@ -0,0 +1,664 @@
+package cli
+
+import (
+	"encoding/base64"
+	"fmt"
+	"github.com/brightbox/gobrightbox"
+	"sort"
+	"strings"
+	"time"
+)
+
+// planAction is one change to make to an account to bring it in line with a
+// manifest: creating, updating or destroying a resource. Changes lists the
+// fields that would change.
+type planAction struct {
+	Action  string
+	Kind    string
+	Name    string
+	Id      string
+	Changes []fieldChange
+	run     func() error
+}
+
+type fieldChange struct {
+	Field string
+	Old   string
+	New   string
+}
+
+func (a *planAction) change(field, old, new string) {
+	a.Changes = append(a.Changes, fieldChange{field, old, new})
+}
+
+var planActionVerbs = map[string]string{
+	"create":  "Creating",
+	"update":  "Updating",
+	"destroy": "Destroying",
+}
+
+// liveState is the current state of an account, as compared with manifests.
+// Resources created while applying are added to it, so that later actions
+// can refer to them by name.
+type liveState struct {
+	client   *Client
+	timeout  time.Duration
+	groups   []brightbox.ServerGroup
+	servers  []brightbox.Server
+	cloudIPs []brightbox.CloudIP
+	ids      map[string]map[string][]string
+	names    map[string]string
+	warnings []string
+}
+
+// fetchLiveState gets the server groups, servers and Cloud IPs of the
+// account, ignoring deleted servers. The names of load balancers and
+// database servers are fetched too, as Cloud IPs can be mapped to them.
+func (c *Client) fetchLiveState() (*liveState, error) {
+	st := &liveState{
+		client:  c,
+		timeout: 2 * time.Minute,
+		ids:     make(map[string]map[string][]string),
+		names:   make(map[string]string),
+	}
+	groups, err := c.ServerGroups()
+	if err != nil {
+		return nil, err
+	}
+	for _, g := range groups {
+		st.groups = append(st.groups, g)
+		st.add("server group", g.Name, g.Id)
+	}
+	servers, err := c.Servers()
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range servers {
+		if s.Status == "deleted" || s.Status == "deleting" {
+			continue
+		}
+		st.servers = append(st.servers, s)
+		st.add("server", s.Name, s.Id)
+	}
+	cloudIPs, err := c.CloudIPs()
+	if err != nil {
+		return nil, err
+	}
+	for _, cip := range cloudIPs {
+		st.cloudIPs = append(st.cloudIPs, cip)
+		st.add("Cloud IP", cip.Name, cip.Id)
+	}
+	lbs, err := c.LoadBalancers()
+	if err != nil {
+		return nil, err
+	}
+	for _, lb := range lbs {
+		if lb.Status != "deleted" {
+			st.add("load balancer", lb.Name, lb.Id)
+		}
+	}
+	dbss, err := c.DatabaseServers()
+	if err != nil {
+		return nil, err
+	}
+	for _, dbs := range dbss {
+		if dbs.Status != "deleted" {
+			st.add("database server", dbs.Name, dbs.Id)
+		}
+	}
+	return st, nil
+}
+
+func (st *liveState) add(kind, name, id string) {
+	if st.ids[kind] == nil {
+		st.ids[kind] = make(map[string][]string)
+	}
+	st.ids[kind][name] = append(st.ids[kind][name], id)
+	st.names[id] = name
+}
+
+// lookup finds the identifier of the resource of a kind with a name, or ""
+// if there isn't one. Names must be unique to be managed by a manifest.
+func (st *liveState) lookup(kind, name string) (string, error) {
+	ids := st.ids[kind][name]
+	switch len(ids) {
+	case 0:
+		return "", nil
+	case 1:
+		return ids[0], nil
+	}
+	return "", fmt.Errorf("Ambiguous %s '%s', it matches: %s", kind, name, strings.Join(ids, ", "))
+}
+
+// refId finds the identifier of a resource referred to by name or identifier
+func (st *liveState) refId(kind, prefix, ref string) (string, error) {
+	if strings.HasPrefix(ref, prefix) && identifierPattern.MatchString(ref) {
+		return ref, nil
+	}
+	id, err := st.lookup(kind, ref)
+	if err != nil {
+		return "", err
+	}
+	if id == "" {
+		return "", fmt.Errorf("No %s named '%s'", kind, ref)
+	}
+	return id, nil
+}
+
+// refName is a reference as shown in plans: the name of the resource where
+// it is known, otherwise the reference itself
+func (st *liveState) refName(ref string) string {
+	if name, ok := st.names[ref]; ok && name != "" {
+		return name
+	}
+	return ref
+}
+
+func (st *liveState) refNames(refs []string) string {
+	names := make([]string, len(refs))
+	for i, ref := range refs {
+		names[i] = st.refName(ref)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+func (st *liveState) warnf(format string, args ...interface{}) {
+	st.warnings = append(st.warnings, fmt.Sprintf(format, args...))
+}
+
+// plan works out the actions needed to bring the account in line with the
+// manifest, in the order to take them: server groups, servers and Cloud IPs
+// are created and updated, then any pruned resources are destroyed.
+func (st *liveState) plan(m *manifest, prune bool) ([]*planAction, error) {
+	if prune && m.Label == "" {
+		return nil, fmt.Errorf("The manifest needs a label to prune resources")
+	}
+	managed := make(map[string]bool)
+	for _, g := range m.ServerGroups {
+		managed["server group/"+g.Name] = true
+	}
+	for _, s := range m.Servers {
+		managed["server/"+s.Name] = true
+	}
+	for _, cip := range m.CloudIPs {
+		managed["Cloud IP/"+cip.Name] = true
+	}
+
+	var actions []*planAction
+	addAction := func(a *planAction, err error) error {
+		if err != nil {
+			return err
+		}
+		if a != nil && len(a.Changes) > 0 {
+			actions = append(actions, a)
+		}
+		return nil
+	}
+	for i := range m.ServerGroups {
+		if err := addAction(st.planServerGroup(&m.ServerGroups[i])); err != nil {
+			return nil, err
+		}
+	}
+	for i := range m.Servers {
+		if err := addAction(st.planServer(&m.Servers[i], managed)); err != nil {
+			return nil, err
+		}
+	}
+	for i := range m.CloudIPs {
+		if err := addAction(st.planCloudIP(&m.CloudIPs[i], managed)); err != nil {
+			return nil, err
+		}
+	}
+	if prune {
+		actions = append(actions, st.planPrune(m.Label, managed)...)
+	}
+	if len(m.Images) > 0 {
+		if err := st.checkImages(m.Images); err != nil {
+			return nil, err
+		}
+	}
+	return actions, nil
+}
+
+// checkImages warns about images in the manifest that no longer exist
+func (st *liveState) checkImages(images []manifestImage) error {
+	all, err := st.client.Images()
+	if err != nil {
+		return err
+	}
+	exists := make(map[string]bool)
+	for _, img := range all {
+		if img.Status != "deleted" {
+			exists[img.Id] = true
+		}
+	}
+	for _, img := range images {
+		if !exists[img.Id] {
+			st.warnf("Image %s (%s) no longer exists, and can't be created by apply", img.Id, img.Name)
+		}
+	}
+	return nil
+}
+
+func (st *liveState) planServerGroup(mg *manifestServerGroup) (*planAction, error) {
+	id, err := st.lookup("server group", mg.Name)
+	if err != nil {
+		return nil, err
+	}
+	a := &planAction{Kind: "server group", Name: mg.Name, Id: id}
+	if id == "" {
+		a.Action = "create"
+		a.change("name", "", mg.Name)
+		if mg.Description != nil {
+			a.change("description", "", *mg.Description)
+		}
+		a.run = func() error {
+			g, err := st.client.CreateServerGroup(&brightbox.ServerGroupOptions{
+				Name:        &mg.Name,
+				Description: mg.Description,
+			})
+			if err != nil {
+				return err
+			}
+			a.Id = g.Id
+			st.add("server group", g.Name, g.Id)
+			return nil
+		}
+		return a, nil
+	}
+
+	var current brightbox.ServerGroup
+	for _, g := range st.groups {
+		if g.Id == id {
+			current = g
+		}
+	}
+	a.Action = "update"
+	if mg.Description != nil && *mg.Description != current.Description {
+		a.change("description", current.Description, *mg.Description)
+	}
+	a.run = func() error {
+		_, err := st.client.UpdateServerGroup(&brightbox.ServerGroupOptions{
+			Id:          id,
+			Description: mg.Description,
+		})
+		return err
+	}
+	return a, nil
+}
+
+// Check the server groups a server refers to exist, or will
+func (st *liveState) checkGroupRefs(ms *manifestServer, managed map[string]bool) error {
+	for _, ref := range ms.Groups {
+		if managed["server group/"+ref] {
+			continue
+		}
+		if _, err := st.refId("server group", "grp-", ref); err != nil {
+			return fmt.Errorf("Server '%s': %s", ms.Name, err.Error())
+		}
+	}
+	return nil
+}
+
+func (st *liveState) groupIds(refs []string) ([]string, error) {
+	ids := make([]string, len(refs))
+	for i, ref := range refs {
+		id, err := st.refId("server group", "grp-", ref)
+		if err != nil {
+			return nil, err
+		}
+		ids[i] = id
+	}
+	return ids, nil
+}
+
+func (st *liveState) planServer(ms *manifestServer, managed map[string]bool) (*planAction, error) {
+	if err := st.checkGroupRefs(ms, managed); err != nil {
+		return nil, err
+	}
+	id, err := st.lookup("server", ms.Name)
+	if err != nil {
+		return nil, err
+	}
+	a := &planAction{Kind: "server", Name: ms.Name, Id: id}
+	if id == "" {
+		a.Action = "create"
+		a.change("name", "", ms.Name)
+		a.change("image", "", ms.Image)
+		if ms.Type != "" {
+			a.change("type", "", ms.Type)
+		}
+		if ms.Zone != "" {
+			a.change("zone", "", ms.Zone)
+		}
+		if len(ms.Groups) > 0 {
+			a.change("groups", "", st.refNames(ms.Groups))
+		}
+		if ms.UserData != nil {
+			a.change("user_data", "", fmt.Sprintf("(%d bytes)", len(*ms.UserData)))
+		}
+		if ms.CompatibilityMode != nil {
+			a.change("compatibility_mode", "", formatBool(*ms.CompatibilityMode))
+		}
+		a.run = func() error {
+			return st.createServer(a, ms)
+		}
+		return a, nil
+	}
+
+	var current brightbox.Server
+	for _, s := range st.servers {
+		if s.Id == id {
+			current = s
+		}
+	}
+	a.Action = "update"
+	if ms.Image != current.Image.Id && ms.Image != current.Image.Name {
+		st.warnf("Server '%s' was built from image %s, not %s. Servers can't be rebuilt, so destroy it to change this.",
+			ms.Name, current.Image.Id, ms.Image)
+	}
+	if ms.Type != "" && ms.Type != current.ServerType.Handle && ms.Type != current.ServerType.Id {
+		st.warnf("Server '%s' is type %s, not %s. Server types can't be changed, so destroy it to change this.",
+			ms.Name, current.ServerType.Handle, ms.Type)
+	}
+	if ms.Zone != "" && ms.Zone != current.Zone.Handle && ms.Zone != current.Zone.Id {
+		st.warnf("Server '%s' is in zone %s, not %s. Servers can't be moved, so destroy it to change this.",
+			ms.Name, current.Zone.Handle, ms.Zone)
+	}
+	if ms.Groups != nil {
+		var currentGroups []string
+		for _, g := range current.ServerGroups {
+			currentGroups = append(currentGroups, g.Id)
+		}
+		if old, new := st.refNames(currentGroups), st.refNames(ms.Groups); old != new {
+			a.change("groups", old, new)
+		}
+	}
+	if ms.CompatibilityMode != nil && *ms.CompatibilityMode != current.CompatibilityMode {
+		a.change("compatibility_mode", formatBool(current.CompatibilityMode), formatBool(*ms.CompatibilityMode))
+	}
+	a.run = func() error {
+		return st.updateServer(a, ms, &current)
+	}
+	return a, nil
+}
+
+func (st *liveState) createServer(a *planAction, ms *manifestServer) error {
+	image, err := st.client.imageResolver().resolve(ms.Image)
+	if err != nil {
+		return err
+	}
+	newServer := brightbox.ServerOptions{
+		Name:              &ms.Name,
+		Image:             image,
+		CompatibilityMode: ms.CompatibilityMode,
+	}
+	if newServer.ServerType, err = st.client.resolveServerTypeId(ms.Type); err != nil {
+		return err
+	}
+	if newServer.Zone, err = st.client.resolveZoneId(ms.Zone); err != nil {
+		return err
+	}
+	if newServer.ServerGroups, err = st.groupIds(ms.Groups); err != nil {
+		return err
+	}
+	if ms.UserData != nil {
+		userData := base64.StdEncoding.EncodeToString([]byte(*ms.UserData))
+		newServer.UserData = &userData
+	}
+	s, err := st.client.CreateServer(&newServer)
+	if err != nil {
+		return err
+	}
+	a.Id = s.Id
+	st.add("server", s.Name, s.Id)
+	return nil
+}
+
+func (st *liveState) updateServer(a *planAction, ms *manifestServer, current *brightbox.Server) error {
+	updateServer := brightbox.ServerOptions{
+		Id:                current.Id,
+		CompatibilityMode: ms.CompatibilityMode,
+	}
+	if ms.Groups != nil && len(ms.Groups) == 0 {
+		// An empty list of groups can't be sent in an update
+		for _, g := range current.ServerGroups {
+			if _, err := st.client.RemoveServersFromServerGroup(g.Id, []string{current.Id}); err != nil {
+				return err
+			}
+		}
+	}
+	groups, err := st.groupIds(ms.Groups)
+	if err != nil {
+		return err
+	}
+	updateServer.ServerGroups = groups
+	_, err = st.client.UpdateServer(&updateServer)
+	return err
+}
+
+// The destination a Cloud IP maps to, as shown in plans
+func (st *liveState) cloudIPDestination(cip *brightbox.CloudIP) string {
+	return st.refName(cloudIPDestinationId(cip))
+}
+
+// destinationId finds the identifier of the resource a Cloud IP is to be
+// mapped to: a server, server group, load balancer or database server by
+// name, or anything else a Cloud IP can be mapped to
+func (st *liveState) destinationId(ref string) (string, error) {
+	for _, kind := range []string{"server", "server group", "load balancer", "database server"} {
+		id, err := st.lookup(kind, ref)
+		if err != nil {
+			return "", err
+		}
+		if id != "" {
+			return id, nil
+		}
+	}
+	dest, err := st.client.resolveCloudIPDestination(ref)
+	if err != nil {
+		return "", err
+	}
+	return dest.Id, nil
+}
+
+// plannedDestinationId is the identifier of the resource a manifest maps a
+// Cloud IP to, or "" to unmap it. A server or server group the manifest is
+// yet to create is returned by name, so never matches a current destination.
+func (st *liveState) plannedDestinationId(ref string, managed map[string]bool) (string, error) {
+	if ref == "" {
+		return "", nil
+	}
+	for _, kind := range []string{"server", "server group"} {
+		id, err := st.lookup(kind, ref)
+		if err != nil {
+			return "", err
+		}
+		if id == "" && managed[kind+"/"+ref] {
+			return ref, nil
+		}
+	}
+	return st.destinationId(ref)
+}
+
+// cloudIPMappedTo is whether a Cloud IP is mapped to a destination, which
+// may be given as a server or its interface
+func cloudIPMappedTo(cip *brightbox.CloudIP, id string) bool {
+	if id != "" && cip.Interface != nil && cip.Interface.Id == id {
+		return true
+	}
+	return cloudIPDestinationId(cip) == id
+}
+
+func (st *liveState) mapCloudIP(id string, ref string) error {
+	dest, err := st.destinationId(ref)
+	if err != nil {
+		return err
+	}
+	if strings.HasPrefix(dest, "srv-") {
+		return st.client.MapCloudIPtoServer(id, dest)
+	}
+	return st.client.MapCloudIP(id, dest)
+}
+
+func (st *liveState) unmapCloudIP(id string) error {
+	if err := st.client.UnMapCloudIP(id); err != nil {
+		return err
+	}
+	return waitForStatus("Cloud IP "+id, st.timeout, st.client.cloudIPStatus(id), "unmapped")
+}
+
+func (st *liveState) planCloudIP(mc *manifestCloudIP, managed map[string]bool) (*planAction, error) {
+	id, err := st.lookup("Cloud IP", mc.Name)
+	if err != nil {
+		return nil, err
+	}
+	a := &planAction{Kind: "Cloud IP", Name: mc.Name, Id: id}
+	var portTranslators []brightbox.PortTranslator
+	if mc.PortTranslators != nil {
+		portTranslators, err = parsePortTranslators(*mc.PortTranslators)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if id == "" {
+		a.Action = "create"
+		a.change("name", "", mc.Name)
+		if mc.ReverseDns != nil {
+			a.change("reverse_dns", "", *mc.ReverseDns)
+		}
+		if len(portTranslators) > 0 {
+			a.change("port_translators", "", formatPortTranslators(portTranslators))
+		}
+		if mc.Map != nil && *mc.Map != "" {
+			a.change("destination", "", st.refName(*mc.Map))
+		}
+		a.run = func() error {
+			cip, err := st.client.CreateCloudIP(&brightbox.CloudIPOptions{
+				Name:            &mc.Name,
+				ReverseDns:      mc.ReverseDns,
+				PortTranslators: portTranslators,
+			})
+			if err != nil {
+				return err
+			}
+			a.Id = cip.Id
+			st.add("Cloud IP", cip.Name, cip.Id)
+			if mc.Map != nil && *mc.Map != "" {
+				return st.mapCloudIP(cip.Id, *mc.Map)
+			}
+			return nil
+		}
+		return a, nil
+	}
+
+	var current brightbox.CloudIP
+	for _, cip := range st.cloudIPs {
+		if cip.Id == id {
+			current = cip
+		}
+	}
+	a.Action = "update"
+	update := false
+	if mc.ReverseDns != nil && *mc.ReverseDns != current.ReverseDns {
+		a.change("reverse_dns", current.ReverseDns, *mc.ReverseDns)
+		update = true
+	}
+	if mc.PortTranslators != nil {
+		old, new := formatPortTranslators(current.PortTranslators), formatPortTranslators(portTranslators)
+		if old != new {
+			a.change("port_translators", old, new)
+			update = true
+		}
+	}
+	remap := false
+	currentDest := st.cloudIPDestination(&current)
+	if mc.Map != nil {
+		dest, err := st.plannedDestinationId(*mc.Map, managed)
+		if err != nil {
+			return nil, fmt.Errorf("Cloud IP '%s': %s", mc.Name, err.Error())
+		}
+		if !cloudIPMappedTo(&current, dest) {
+			a.change("destination", currentDest, st.refName(*mc.Map))
+			remap = true
+		}
+	}
+	a.run = func() error {
+		if update {
+			_, err := st.client.updateCloudIP(&brightbox.CloudIPOptions{
+				Id:              id,
+				ReverseDns:      mc.ReverseDns,
+				PortTranslators: portTranslators,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		if !remap {
+			return nil
+		}
+		if currentDest != "" {
+			if err := st.unmapCloudIP(id); err != nil {
+				return err
+			}
+		}
+		if *mc.Map != "" {
+			return st.mapCloudIP(id, *mc.Map)
+		}
+		return nil
+	}
+	return a, nil
+}
+
+// planPrune destroys the labelled resources the manifest doesn't manage:
+// Cloud IPs first, so they are unmapped from servers before the servers go,
+// then servers, then server groups.
+func (st *liveState) planPrune(label string, managed map[string]bool) []*planAction {
+	var actions []*planAction
+	prunable := func(kind, name string) bool {
+		return strings.HasPrefix(name, label) && !managed[kind+"/"+name]
+	}
+	for _, cip := range st.cloudIPs {
+		if !prunable("Cloud IP", cip.Name) {
+			continue
+		}
+		cip := cip
+		a := &planAction{Action: "destroy", Kind: "Cloud IP", Name: cip.Name, Id: cip.Id}
+		a.change("name", cip.Name, "")
+		a.run = func() error {
+			if cip.Status == "mapped" {
+				if err := st.unmapCloudIP(cip.Id); err != nil {
+					return err
+				}
+			}
+			return st.client.DestroyCloudIP(cip.Id)
+		}
+		actions = append(actions, a)
+	}
+	for _, s := range st.servers {
+		if !prunable("server", s.Name) {
+			continue
+		}
+		id := s.Id
+		a := &planAction{Action: "destroy", Kind: "server", Name: s.Name, Id: id}
+		a.change("name", s.Name, "")
+		a.run = func() error {
+			return st.client.DestroyServer(id)
+		}
+		actions = append(actions, a)
+	}
+	for _, g := range st.groups {
+		if g.Default || !prunable("server group", g.Name) {
+			continue
+		}
+		id := g.Id
+		a := &planAction{Action: "destroy", Kind: "server group", Name: g.Name, Id: id}
+		a.change("name", g.Name, "")
+		a.run = func() error {
+			return st.client.DestroyServerGroup(id)
+		}
+		actions = append(actions, a)
+	}
+	return actions
+}
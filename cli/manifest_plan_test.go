@@ -0,0 +1,255 @@
+package cli
+
+import (
+	"fmt"
+	"github.com/brightbox/gobrightbox"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testLiveState is an account with a default group, a labelled group with a
+// server in it, and a Cloud IP mapped to that server
+func testLiveState() *liveState {
+	st := &liveState{ids: make(map[string]map[string][]string), names: make(map[string]string)}
+
+	var def, web brightbox.ServerGroup
+	def.Id, def.Name, def.Default = "grp-defal", "default", true
+	web.Id, web.Name, web.Description = "grp-webbb", "prod-web", "Web servers"
+	st.groups = []brightbox.ServerGroup{def, web}
+
+	var server brightbox.Server
+	server.Id, server.Name, server.Status = "srv-web01", "prod-web-1", "active"
+	server.Image.Id, server.Image.Name = "img-ubunt", "ubuntu"
+	server.ServerType.Id, server.ServerType.Handle = "typ-small", "small"
+	server.Zone.Id, server.Zone.Handle = "zon-gb1aa", "gb1-a"
+	server.ServerGroups = []brightbox.ServerGroup{web}
+	st.servers = []brightbox.Server{server}
+
+	var cip brightbox.CloudIP
+	cip.Id, cip.Name, cip.Status, cip.ReverseDns = "cip-web01", "prod-web-ip", "mapped", "www.example.com"
+	cip.PortTranslators = []brightbox.PortTranslator{{Incoming: 80, Outgoing: 8080, Protocol: "tcp"}}
+	cip.Server = &st.servers[0]
+	st.cloudIPs = []brightbox.CloudIP{cip}
+
+	for _, g := range st.groups {
+		st.add("server group", g.Name, g.Id)
+	}
+	st.add("server", server.Name, server.Id)
+	st.add("Cloud IP", cip.Name, cip.Id)
+	return st
+}
+
+// planSummary describes each action as one string, for comparing plans
+func planSummary(actions []*planAction) []string {
+	var summary []string
+	for _, a := range actions {
+		var changes []string
+		for _, c := range a.Changes {
+			changes = append(changes, fmt.Sprintf("%s:%s>%s", c.Field, c.Old, c.New))
+		}
+		summary = append(summary, fmt.Sprintf("%s %s %s %s", a.Action, a.Kind, a.Name, strings.Join(changes, " ")))
+	}
+	return summary
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+func TestLiveStatePlan(t *testing.T) {
+	tests := []struct {
+		name     string
+		manifest manifest
+		prune    bool
+		want     []string
+		warnings int
+	}{
+		{
+			name: "unchanged",
+			manifest: manifest{
+				ServerGroups: []manifestServerGroup{{Name: "prod-web", Description: stringPtr("Web servers")}},
+				Servers:      []manifestServer{{Name: "prod-web-1", Image: "ubuntu", Type: "small", Zone: "gb1-a", Groups: []string{"prod-web"}}},
+				CloudIPs:     []manifestCloudIP{{Name: "prod-web-ip", ReverseDns: stringPtr("www.example.com"), PortTranslators: stringPtr("80:8080:tcp"), Map: stringPtr("prod-web-1")}},
+			},
+		},
+		{
+			name: "create",
+			manifest: manifest{
+				ServerGroups: []manifestServerGroup{{Name: "prod-db", Description: stringPtr("Databases")}},
+				Servers:      []manifestServer{{Name: "prod-db-1", Image: "img-ubunt", Type: "medium", Groups: []string{"prod-db"}, CompatibilityMode: boolPtr(true)}},
+				CloudIPs:     []manifestCloudIP{{Name: "prod-db-ip", Map: stringPtr("prod-web-1")}},
+			},
+			want: []string{
+				"create server group prod-db name:>prod-db description:>Databases",
+				"create server prod-db-1 name:>prod-db-1 image:>img-ubunt type:>medium groups:>prod-db compatibility_mode:>true",
+				"create Cloud IP prod-db-ip name:>prod-db-ip destination:>prod-web-1",
+			},
+		},
+		{
+			name: "update",
+			manifest: manifest{
+				ServerGroups: []manifestServerGroup{{Name: "prod-web", Description: stringPtr("Frontend")}},
+				Servers:      []manifestServer{{Name: "prod-web-1", Image: "ubuntu", Groups: []string{"default", "prod-web"}}},
+				CloudIPs:     []manifestCloudIP{{Name: "prod-web-ip", PortTranslators: stringPtr(""), Map: stringPtr("")}},
+			},
+			want: []string{
+				"update server group prod-web description:Web servers>Frontend",
+				"update server prod-web-1 groups:prod-web>default,prod-web",
+				"update Cloud IP prod-web-ip port_translators:80:8080:tcp> destination:prod-web-1>",
+			},
+		},
+		{
+			name: "settings left out are left alone",
+			manifest: manifest{
+				ServerGroups: []manifestServerGroup{{Name: "prod-web"}},
+				Servers:      []manifestServer{{Name: "prod-web-1", Image: "ubuntu"}},
+				CloudIPs:     []manifestCloudIP{{Name: "prod-web-ip"}},
+			},
+		},
+		{
+			name: "servers can't be rebuilt",
+			manifest: manifest{
+				Servers: []manifestServer{{Name: "prod-web-1", Image: "debian", Type: "large", Zone: "gb1-b"}},
+			},
+			warnings: 3,
+		},
+		{
+			name:     "prune",
+			manifest: manifest{Label: "prod-", ServerGroups: []manifestServerGroup{{Name: "prod-web"}}},
+			prune:    true,
+			want: []string{
+				"destroy Cloud IP prod-web-ip name:prod-web-ip>",
+				"destroy server prod-web-1 name:prod-web-1>",
+			},
+		},
+		{
+			name:     "prune only labelled resources",
+			manifest: manifest{Label: "test-"},
+			prune:    true,
+		},
+	}
+	for _, test := range tests {
+		st := testLiveState()
+		actions, err := st.plan(&test.manifest, test.prune)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err)
+			continue
+		}
+		if got := planSummary(actions); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got plan\n%s\nwant\n%s", test.name, strings.Join(got, "\n"), strings.Join(test.want, "\n"))
+		}
+		if len(st.warnings) != test.warnings {
+			t.Errorf("%s: got warnings %q, want %d", test.name, st.warnings, test.warnings)
+		}
+	}
+}
+
+func TestLiveStatePlanErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		manifest manifest
+		prune    bool
+		err      string
+	}{
+		{
+			name:     "missing group",
+			manifest: manifest{Servers: []manifestServer{{Name: "prod-web-2", Image: "ubuntu", Groups: []string{"prod-app"}}}},
+			err:      "Server 'prod-web-2': No server group named 'prod-app'",
+		},
+		{
+			name:     "prune without a label",
+			manifest: manifest{},
+			prune:    true,
+			err:      "The manifest needs a label to prune resources",
+		},
+		{
+			name:     "bad port translators",
+			manifest: manifest{CloudIPs: []manifestCloudIP{{Name: "prod-web-ip", PortTranslators: stringPtr("80")}}},
+			err:      "Invalid port translator '80', expected in:out:protocol",
+		},
+	}
+	for _, test := range tests {
+		_, err := testLiveState().plan(&test.manifest, test.prune)
+		if err == nil || err.Error() != test.err {
+			t.Errorf("%s: got error %v, want %q", test.name, err, test.err)
+		}
+	}
+}
+
+func TestLiveStatePlanAmbiguousName(t *testing.T) {
+	st := testLiveState()
+	st.add("server", "prod-web-1", "srv-web02")
+	m := manifest{Servers: []manifestServer{{Name: "prod-web-1", Image: "ubuntu"}}}
+	if _, err := st.plan(&m, false); err == nil || !strings.Contains(err.Error(), "Ambiguous server") {
+		t.Errorf("got error %v, want an ambiguous name error", err)
+	}
+}
+
+func TestLiveStatePlanCloudIPDestination(t *testing.T) {
+	tests := []struct {
+		name     string
+		manifest manifest
+		want     []string
+	}{
+		{
+			name:     "load balancer by name",
+			manifest: manifest{CloudIPs: []manifestCloudIP{{Name: "prod-lb-ip", Map: stringPtr("prod-lb")}}},
+		},
+		{
+			name:     "load balancer by identifier",
+			manifest: manifest{CloudIPs: []manifestCloudIP{{Name: "prod-lb-ip", Map: stringPtr("lba-lbweb")}}},
+		},
+		{
+			name:     "server by interface",
+			manifest: manifest{CloudIPs: []manifestCloudIP{{Name: "prod-web-ip", Map: stringPtr("int-web01")}}},
+		},
+		{
+			name:     "remap to a database server",
+			manifest: manifest{CloudIPs: []manifestCloudIP{{Name: "prod-lb-ip", Map: stringPtr("prod-db")}}},
+			want:     []string{"update Cloud IP prod-lb-ip destination:prod-lb>prod-db"},
+		},
+		{
+			name:     "remap to a server",
+			manifest: manifest{CloudIPs: []manifestCloudIP{{Name: "prod-lb-ip", Map: stringPtr("prod-web-1")}}},
+			want:     []string{"update Cloud IP prod-lb-ip destination:prod-lb>prod-web-1"},
+		},
+		{
+			name: "remap to a server yet to be created",
+			manifest: manifest{
+				Servers:  []manifestServer{{Name: "prod-web-2", Image: "ubuntu"}},
+				CloudIPs: []manifestCloudIP{{Name: "prod-lb-ip", Map: stringPtr("prod-web-2")}},
+			},
+			want: []string{
+				"create server prod-web-2 name:>prod-web-2 image:>ubuntu",
+				"update Cloud IP prod-lb-ip destination:prod-lb>prod-web-2",
+			},
+		},
+	}
+	for _, test := range tests {
+		st := testLiveState()
+		st.cloudIPs[0].Interface = new(brightbox.ServerInterface)
+		st.cloudIPs[0].Interface.Id = "int-web01"
+		st.add("load balancer", "prod-lb", "lba-lbweb")
+		st.add("database server", "prod-db", "dbs-dbweb")
+		var cip brightbox.CloudIP
+		cip.Id, cip.Name, cip.Status = "cip-lbweb", "prod-lb-ip", "mapped"
+		cip.LoadBalancer = new(brightbox.LoadBalancer)
+		cip.LoadBalancer.Id = "lba-lbweb"
+		st.cloudIPs = append(st.cloudIPs, cip)
+		st.add("Cloud IP", cip.Name, cip.Id)
+
+		actions, err := st.plan(&test.manifest, false)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err)
+			continue
+		}
+		if got := planSummary(actions); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got plan\n%s\nwant\n%s", test.name, strings.Join(got, "\n"), strings.Join(test.want, "\n"))
+		}
+	}
+}
@@ -1,111 +1,493 @@
 package cli
 
 import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
 	"fmt"
+	"gopkg.in/alecthomas/kingpin.v2"
+	"gopkg.in/yaml.v2"
 	"io"
 	"os"
 	"reflect"
+	"sort"
+	"strconv"
 	"strings"
 	"text/tabwriter"
+	"text/template"
 	"time"
 )
 
+var (
+	outputFormats = []string{"text", "json", "yaml", "csv", "tsv"}
+)
+
+// A single resource to be output, as its display fields and the API object
+// they were built from
+type outputRecord struct {
+	Fields map[string]string
+	Object interface{}
+}
+
+// FieldOutput collects records and renders them in the output format chosen
+// with the global --format flag when flushed
 type FieldOutput struct {
-	Writer *tabwriter.Writer
+	Writer     io.Writer
+	Format     string
+	FieldOrder []string
+	Raw        bool
+	Template   *template.Template
+	JSONPath   *jsonPath
+	Filter     *fieldFilter
+	SortFields []string
+	Reverse    bool
+	Limit      int
+	records    []outputRecord
 }
 
+// RowFieldOutput renders records as a table, one row per record
 type RowFieldOutput struct {
 	FieldOutput
-	FieldOrder []string
 }
 
+// ShowFieldOutput renders a single record as a list of fields
 type ShowFieldOutput struct {
 	FieldOutput
-	FieldOrder []string
 }
 
-func (fo *FieldOutput) Flush() {
-	fo.Writer.Flush()
+func checkOutputFormat(format string) error {
+	for _, f := range outputFormats {
+		if format == f {
+			return nil
+		}
+	}
+	return fmt.Errorf("Unknown output format '%s', must be one of: %s", format, strings.Join(outputFormats, ", "))
 }
 
-func (fo *RowFieldOutput) Setup(fieldorder []string) {
-	fo.Writer = tabwriter.NewWriter(os.Stdout, 1, 2, 2, ' ', 0)
+func (fo *FieldOutput) Setup(format string, fieldorder []string, raw bool) error {
+	if err := checkOutputFormat(format); err != nil {
+		return err
+	}
+	fo.Writer = os.Stdout
+	fo.Format = format
 	fo.FieldOrder = fieldorder
+	fo.Raw = raw
+	return nil
 }
 
-func (fo *ShowFieldOutput) Setup(fieldorder []string) {
-	fo.Writer = tabwriter.NewWriter(os.Stdout, 1, 2, 2, ' ', tabwriter.AlignRight)
-	fo.FieldOrder = fieldorder
+// SetTemplate sets a Go template to render each record with, instead of the
+// output format
+func (fo *FieldOutput) SetTemplate(text string) error {
+	tmpl, err := template.New("output").Parse(text)
+	if err != nil {
+		return err
+	}
+	fo.Template = tmpl
+	return nil
 }
 
-func (fo *RowFieldOutput) SendHeader() {
-	for i, f := range fo.FieldOrder {
-		fmt.Fprint(fo.Writer, strings.ToUpper(f))
-		if i+1 < len(fo.FieldOrder) {
-			fo.Writer.Write([]byte{'\t'})
-		} else {
-			fo.Writer.Write([]byte{'\n'})
+// SetJSONPath sets a JSONPath template to render each record with, instead
+// of the output format
+func (fo *FieldOutput) SetJSONPath(text string) error {
+	jp, err := parseJSONPath(text)
+	if err != nil {
+		return err
+	}
+	fo.JSONPath = jp
+	return nil
+}
+
+func (c *CLIApp) setupOutput(fo *FieldOutput, fields string) error {
+	err := fo.Setup(c.Format, strings.Split(fields, ","), c.Raw)
+	if err != nil {
+		return err
+	}
+	if c.Template != "" && c.JSONPath != "" {
+		return fmt.Errorf("Only one of --template and --jsonpath can be used")
+	}
+	if c.Template != "" {
+		return fo.SetTemplate(c.Template)
+	}
+	if c.JSONPath != "" {
+		return fo.SetJSONPath(c.JSONPath)
+	}
+	return nil
+}
+
+// rowOutput returns a RowFieldOutput set up with the global output options
+// and the given comma separated list of fields
+func (c *CLIApp) rowOutput(fields string) (*RowFieldOutput, error) {
+	out := new(RowFieldOutput)
+	err := c.setupOutput(&out.FieldOutput, fields)
+	if err != nil {
+		return nil, err
+	}
+	if c.Filter != "" {
+		out.Filter, err = parseFieldFilter(c.Filter)
+		if err != nil {
+			return nil, err
 		}
 	}
+	if c.Sort != "" {
+		out.SortFields = strings.Split(c.Sort, ",")
+	}
+	out.Reverse = c.Reverse
+	if c.Limit < 0 {
+		return nil, fmt.Errorf("--limit must not be negative")
+	}
+	out.Limit = c.Limit
+	return out, nil
+}
+
+// listFlags adds the flags common to all list commands
+func (c *CLIApp) listFlags(cmd *kingpin.CmdClause) {
+	cmd.Flag("filter", "Only list resources whose fields match, e.g: status=active,zone=gb1-a,name~^web-,ram>=4096").
+		StringVar(&c.Filter)
+	cmd.Flag("sort", "Sort by the given comma separated fields, e.g: zone,created_at").
+		StringVar(&c.Sort)
+	cmd.Flag("reverse", "Reverse the order of the list").
+		BoolVar(&c.Reverse)
+	cmd.Flag("limit", "List at most this many resources").
+		IntVar(&c.Limit)
+}
+
+// showOutput returns a ShowFieldOutput set up with the global output options
+// and the given comma separated list of fields
+func (c *CLIApp) showOutput(fields string) (*ShowFieldOutput, error) {
+	out := new(ShowFieldOutput)
+	err := c.setupOutput(&out.FieldOutput, fields)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
 }
-func (fo *RowFieldOutput) Write(fields map[string]string) error {
-	for i, f := range fo.FieldOrder {
-		v, ok := fields[f]
-		if ok == false {
-			return fmt.Errorf("No field named '%s' available for display", f)
+
+// Write adds a record to be output. obj is the API object the fields were
+// built from, used for raw output. It may be nil, in which case the fields
+// are used instead.
+func (fo *FieldOutput) Write(fields map[string]string, obj interface{}) error {
+	if fo.Template == nil && fo.JSONPath == nil {
+		for _, f := range fo.order(fields) {
+			if _, ok := fields[f]; ok == false {
+				return fmt.Errorf("No field named '%s' available for display", f)
+			}
 		}
-		fmt.Fprint(fo.Writer, v)
-		if i+1 < len(fo.FieldOrder) {
-			fo.Writer.Write([]byte{'\t'})
-		} else {
-			fo.Writer.Write([]byte{'\n'})
+	}
+	if fo.Filter != nil {
+		match, err := fo.Filter.Match(fields)
+		if err != nil || !match {
+			return err
 		}
 	}
+	fo.records = append(fo.records, outputRecord{Fields: fields, Object: obj})
 	return nil
 }
-func (fo *ShowFieldOutput) Write(fields map[string]string) error {
-	var order = fo.FieldOrder
-	if len(order) == 1 && order[0] == "all" {
-		order = []string{}
+
+// The fields to output for a record. A field order of just "all" means every
+// field, in name order.
+func (fo *FieldOutput) order(fields map[string]string) []string {
+	if len(fo.FieldOrder) == 1 && fo.FieldOrder[0] == "all" {
+		order := make([]string, 0, len(fields))
 		for k := range fields {
 			order = append(order, k)
 		}
+		sort.Strings(order)
+		return order
+	}
+	return fo.FieldOrder
+}
+
+// The columns of tabular output, taken from the first record
+func (fo *FieldOutput) columns() []string {
+	if len(fo.records) > 0 {
+		return fo.order(fo.records[0].Fields)
 	}
-	for _, f := range order {
-		v, ok := fields[f]
-		if ok == false {
-			return fmt.Errorf("No field named '%s' available for display", f)
+	return fo.FieldOrder
+}
+
+func (fo *RowFieldOutput) Flush() error {
+	if err := fo.arrange(); err != nil {
+		return err
+	}
+	if fo.Template != nil || fo.JSONPath != nil {
+		return fo.writeTemplated()
+	}
+	switch fo.Format {
+	case "json", "yaml":
+		return fo.encodeRecords(false)
+	case "csv", "tsv":
+		return fo.writeDelimited()
+	}
+	w := tabwriter.NewWriter(fo.Writer, 1, 2, 2, ' ', 0)
+	order := fo.columns()
+	header := make([]string, len(order))
+	for i, f := range order {
+		header[i] = strings.ToUpper(f)
+	}
+	fmt.Fprintln(w, strings.Join(header, "\t"))
+	for _, r := range fo.records {
+		row := make([]string, len(order))
+		for i, f := range order {
+			row[i] = r.Fields[f]
 		}
-		fmt.Fprint(fo.Writer, f, ": \t", v)
-		fo.Writer.Write([]byte{'\n'})
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	return w.Flush()
+}
+
+func (fo *ShowFieldOutput) Flush() error {
+	if fo.Template != nil || fo.JSONPath != nil {
+		return fo.writeTemplated()
+	}
+	switch fo.Format {
+	case "json", "yaml":
+		return fo.encodeRecords(true)
+	case "csv", "tsv":
+		return fo.writeDelimited()
+	}
+	w := tabwriter.NewWriter(fo.Writer, 1, 2, 2, ' ', tabwriter.AlignRight)
+	for _, r := range fo.records {
+		for _, f := range fo.order(r.Fields) {
+			fmt.Fprint(w, f, ": \t", r.Fields[f], "\n")
+		}
+	}
+	return w.Flush()
+}
+
+// The value to encode for a record in structured formats: either the raw API
+// object or the selected fields
+func (fo *FieldOutput) structuredValue(r outputRecord) (interface{}, error) {
+	if fo.Raw && r.Object != nil {
+		if fo.Format == "yaml" {
+			// Go via json so the keys match the API's
+			return genericValue(r.Object)
+		}
+		return r.Object, nil
+	}
+	return orderedFields{order: fo.order(r.Fields), fields: r.Fields}, nil
+}
+
+// Encode the records as a json or yaml list. A single record can be encoded on
+// its own rather than as a list.
+func (fo *FieldOutput) encodeRecords(single bool) error {
+	if single && len(fo.records) == 1 {
+		v, err := fo.structuredValue(fo.records[0])
+		if err != nil {
+			return err
+		}
+		return fo.encode(v)
+	}
+	values := make([]interface{}, len(fo.records))
+	for i, r := range fo.records {
+		v, err := fo.structuredValue(r)
+		if err != nil {
+			return err
+		}
+		values[i] = v
+	}
+	return fo.encode(values)
+}
+
+func (fo *FieldOutput) encode(v interface{}) error {
+	if fo.Format == "yaml" {
+		y, err := yaml.Marshal(v)
+		if err != nil {
+			return err
+		}
+		_, err = fo.Writer.Write(y)
+		return err
+	}
+	j, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(fo.Writer, "%s\n", j)
+	return err
+}
+
+func (fo *FieldOutput) writeDelimited() error {
+	w := csv.NewWriter(fo.Writer)
+	if fo.Format == "tsv" {
+		w.Comma = '\t'
+	}
+	order := fo.columns()
+	if err := w.Write(order); err != nil {
+		return err
+	}
+	for _, r := range fo.records {
+		row := make([]string, len(order))
+		for i, f := range order {
+			row[i] = r.Fields[f]
+		}
+		if err := w.Write(row); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// Sort, reverse and limit the records as chosen. Without any sort fields the
+// order the records were written in is kept.
+func (fo *FieldOutput) arrange() error {
+	if len(fo.SortFields) > 0 && len(fo.records) > 0 {
+		for _, f := range fo.SortFields {
+			if _, ok := fo.records[0].Fields[f]; !ok {
+				return fmt.Errorf("No field named '%s' available to sort by", f)
+			}
+		}
+		sort.SliceStable(fo.records, func(i, j int) bool {
+			for _, f := range fo.SortFields {
+				cmp := compareFieldValues(fo.records[i].Fields[f], fo.records[j].Fields[f])
+				if cmp != 0 {
+					return cmp < 0
+				}
+			}
+			return false
+		})
+	}
+	if fo.Reverse {
+		for i, j := 0, len(fo.records)-1; i < j; i, j = i+1, j-1 {
+			fo.records[i], fo.records[j] = fo.records[j], fo.records[i]
+		}
+	}
+	if fo.Limit > 0 && len(fo.records) > fo.Limit {
+		fo.records = fo.records[:fo.Limit]
 	}
 	return nil
 }
 
-func tabWriter() *tabwriter.Writer {
-	return tabwriter.NewWriter(os.Stdout, 1, 2, 2, ' ', 0)
+// The layouts of dates and times in the field maps
+var fieldTimeLayouts = []string{
+	"2006-01-02 15:04:05.999999999 -0700 MST",
+	time.RFC3339,
+	"2006-01-02",
 }
 
-func tabWriterRight() *tabwriter.Writer {
-	return tabwriter.NewWriter(os.Stdout, 1, 2, 2, ' ', tabwriter.AlignRight)
+func parseFieldTime(s string) (time.Time, bool) {
+	for _, layout := range fieldTimeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
 }
 
-func listRec(w io.Writer, a ...interface{}) {
-	for i, x := range a {
-		fmt.Fprint(w, x)
-		if i+1 < len(a) {
-			w.Write([]byte{'\t'})
+// compareFieldValues compares two field values as numbers when they both
+// are, as times when they both are, and otherwise as strings. It returns -1,
+// 0 or 1 like strings.Compare.
+func compareFieldValues(a, b string) int {
+	if fa, err := strconv.ParseFloat(a, 64); err == nil {
+		if fb, err := strconv.ParseFloat(b, 64); err == nil {
+			switch {
+			case fa < fb:
+				return -1
+			case fa > fb:
+				return 1
+			}
+			return 0
+		}
+	}
+	if ta, ok := parseFieldTime(a); ok {
+		if tb, ok := parseFieldTime(b); ok {
+			switch {
+			case ta.Before(tb):
+				return -1
+			case ta.After(tb):
+				return 1
+			}
+			return 0
+		}
+	}
+	return strings.Compare(a, b)
+}
+
+// Render each record with the template or JSONPath, one per line. The
+// template is given all the fields of the record, or the API object with
+// --raw.
+func (fo *FieldOutput) writeTemplated() error {
+	for _, r := range fo.records {
+		var data interface{} = r.Fields
+		if fo.Raw && r.Object != nil {
+			data = r.Object
+		}
+		data, err := genericValue(data)
+		if err != nil {
+			return err
+		}
+		var s string
+		if fo.Template != nil {
+			var b bytes.Buffer
+			if err = fo.Template.Execute(&b, data); err != nil {
+				return err
+			}
+			s = b.String()
 		} else {
-			w.Write([]byte{'\n'})
+			s, err = fo.JSONPath.Execute(data)
+			if err != nil {
+				return err
+			}
+		}
+		if !strings.HasSuffix(s, "\n") {
+			s += "\n"
+		}
+		if _, err = io.WriteString(fo.Writer, s); err != nil {
+			return err
 		}
 	}
+	return nil
+}
+
+// orderedFields marshals a map of fields in the given field order
+type orderedFields struct {
+	order  []string
+	fields map[string]string
 }
 
-func drawShow(w io.Writer, d []interface{}) {
-	for i := 0; i+1 < len(d); i += 2 {
-		fmt.Fprint(w, d[i], ": \t", d[i+1])
-		w.Write([]byte{'\n'})
+func (o orderedFields) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, f := range o.order {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		k, err := json.Marshal(f)
+		if err != nil {
+			return nil, err
+		}
+		v, err := json.Marshal(o.fields[f])
+		if err != nil {
+			return nil, err
+		}
+		b.Write(k)
+		b.WriteByte(':')
+		b.Write(v)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+func (o orderedFields) MarshalYAML() (interface{}, error) {
+	ms := make(yaml.MapSlice, len(o.order))
+	for i, f := range o.order {
+		ms[i] = yaml.MapItem{Key: f, Value: o.fields[f]}
+	}
+	return ms, nil
+}
+
+// genericValue converts an object into plain maps and slices via its json
+// encoding
+func genericValue(obj interface{}) (interface{}, error) {
+	j, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	var v interface{}
+	err = json.Unmarshal(j, &v)
+	if err != nil {
+		return nil, err
 	}
+	return v, nil
 }
 
 func formatTime(t *time.Time) string {
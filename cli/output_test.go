@@ -0,0 +1,81 @@
+package cli
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCompareFieldValues(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"2", "10", -1},
+		{"10", "2", 1},
+		{"4096", "4096.0", 0},
+		{"-1", "0", -1},
+		{"2018-03-01", "2017-12-31", 1},
+		{"2018-03-01T10:00:00Z", "2018-03-01T11:00:00+01:00", 0},
+		{"2018-03-01 10:00:00 +0000 UTC", "2018-03-01 10:00:01 +0000 UTC", -1},
+		{"srv-10", "srv-2", -1},
+		{"web", "web", 0},
+		{"10", "web", -1},
+		{"", "a", -1},
+	}
+	for _, test := range tests {
+		if got := compareFieldValues(test.a, test.b); got != test.want {
+			t.Errorf("compareFieldValues(%q, %q) = %d, want %d", test.a, test.b, got, test.want)
+		}
+	}
+}
+
+func TestFieldOutputArrange(t *testing.T) {
+	rows := [][3]string{
+		{"srv-aaaaa", "512", "2018-01-02 10:00:00 +0000 UTC"},
+		{"srv-bbbbb", "4096", "2018-01-02 10:00:00 +0000 UTC"},
+		{"srv-ccccc", "16384", "2017-01-02 10:00:00 +0000 UTC"},
+		{"srv-ddddd", "4096", "2019-01-02 10:00:00 +0000 UTC"},
+	}
+	tests := []struct {
+		sort    []string
+		reverse bool
+		limit   int
+		want    []string
+	}{
+		{nil, false, 0, []string{"srv-aaaaa", "srv-bbbbb", "srv-ccccc", "srv-ddddd"}},
+		{[]string{"ram"}, false, 0, []string{"srv-aaaaa", "srv-bbbbb", "srv-ddddd", "srv-ccccc"}},
+		{[]string{"ram", "created_at"}, true, 0, []string{"srv-ccccc", "srv-ddddd", "srv-bbbbb", "srv-aaaaa"}},
+		{[]string{"created_at"}, false, 2, []string{"srv-ccccc", "srv-aaaaa"}},
+		{nil, true, 1, []string{"srv-ddddd"}},
+		{nil, false, 10, []string{"srv-aaaaa", "srv-bbbbb", "srv-ccccc", "srv-ddddd"}},
+	}
+	for _, test := range tests {
+		fo := FieldOutput{SortFields: test.sort, Reverse: test.reverse, Limit: test.limit}
+		for _, r := range rows {
+			fo.records = append(fo.records, outputRecord{
+				Fields: map[string]string{"id": r[0], "ram": r[1], "created_at": r[2]},
+			})
+		}
+		if err := fo.arrange(); err != nil {
+			t.Errorf("%v: unexpected error: %s", test.sort, err)
+			continue
+		}
+		var got []string
+		for _, r := range fo.records {
+			got = append(got, r.Fields["id"])
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("sort %v, reverse %v, limit %d: got %v, want %v", test.sort, test.reverse, test.limit, got, test.want)
+		}
+	}
+}
+
+func TestFieldOutputArrangeUnknownField(t *testing.T) {
+	fo := FieldOutput{
+		SortFields: []string{"colour"},
+		records:    []outputRecord{{Fields: map[string]string{"id": "srv-aaaaa"}}},
+	}
+	if err := fo.arrange(); err == nil {
+		t.Error("expected an error sorting by an unknown field")
+	}
+}
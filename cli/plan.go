@@ -0,0 +1,111 @@
+package cli
+
+import (
+	"fmt"
+	"gopkg.in/alecthomas/kingpin.v2"
+	"io"
+	"os"
+)
+
+const (
+	colorReset  = "\033[0m"
+	colorRed    = "\033[31m"
+	colorGreen  = "\033[32m"
+	colorYellow = "\033[33m"
+)
+
+var planActionSymbols = map[string]string{
+	"create":  "+",
+	"update":  "~",
+	"destroy": "-",
+}
+
+var planActionColors = map[string]string{
+	"create":  colorGreen,
+	"update":  colorYellow,
+	"destroy": colorRed,
+}
+
+// useColor decides whether to colour output to stdout: always, never, or
+// when it is a terminal and NO_COLOR isn't set
+func useColor(mode string) bool {
+	switch mode {
+	case "always":
+		return true
+	case "never":
+		return false
+	}
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	fi, err := os.Stdout.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// writePlan shows the actions as a diff, one line per resource followed by a
+// line per changed field
+func writePlan(w io.Writer, actions []*planAction, color bool) {
+	paint := func(c, s string) string {
+		if !color {
+			return s
+		}
+		return c + s + colorReset
+	}
+	for _, a := range actions {
+		c := planActionColors[a.Action]
+		symbol := planActionSymbols[a.Action]
+		header := fmt.Sprintf("%s %s %s", symbol, a.Kind, a.Name)
+		if a.Id != "" {
+			header += " (" + a.Id + ")"
+		}
+		fmt.Fprintln(w, paint(c, header))
+		for _, ch := range a.Changes {
+			switch a.Action {
+			case "create":
+				fmt.Fprintln(w, paint(c, fmt.Sprintf("    %s: %q", ch.Field, ch.New)))
+			case "destroy":
+				fmt.Fprintln(w, paint(c, fmt.Sprintf("    %s: %q", ch.Field, ch.Old)))
+			default:
+				fmt.Fprintf(w, "    %s: %s -> %s\n", ch.Field,
+					paint(colorRed, fmt.Sprintf("%q", ch.Old)), paint(colorGreen, fmt.Sprintf("%q", ch.New)))
+			}
+		}
+	}
+}
+
+func (l *manifestCommand) plan(pc *kingpin.ParseContext) error {
+	err := l.Configure()
+	if err != nil {
+		return err
+	}
+	actions, err := l.planManifest()
+	if err != nil {
+		return err
+	}
+	if len(actions) == 0 {
+		fmt.Println("No changes. The account matches the manifest.")
+		return nil
+	}
+	writePlan(os.Stdout, actions, useColor(l.Color))
+
+	counts := make(map[string]int)
+	for _, a := range actions {
+		counts[a.Action]++
+	}
+	fmt.Printf("\nPlan: %d to create, %d to update, %d to destroy\n", counts["create"], counts["update"], counts["destroy"])
+	if l.DetailedExitcode {
+		return ExitStatus(2)
+	}
+	return nil
+}
+
+func configurePlanCommand(app *CLIApp) {
+	cmd := manifestCommand{CLIApp: app}
+	plan := app.Command("plan", "Show the changes apply would make to match a manifest").
+		Alias("diff").Action(cmd.plan)
+	cmd.manifestFlags(plan)
+	plan.Flag("detailed-exitcode", "Exit with status 2 if there are changes, 0 if there are none").
+		BoolVar(&cmd.DetailedExitcode)
+	plan.Flag("color", "When to colour the output: auto, always or never").
+		Default("auto").EnumVar(&cmd.Color, "auto", "always", "never")
+}
@@ -0,0 +1,260 @@
+package cli
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// resourceHandle is a resource as seen by a resolver: its identifier and the
+// names it can be referred to by, the first of which is its display name.
+type resourceHandle struct {
+	Id    string
+	Names []string
+}
+
+// resolver turns the handles given on the command line into identifiers of
+// one kind of resource. A handle can be an identifier, an exact name, a
+// hostname or fqdn, or a prefix of a name that only one resource has.
+//
+// The resources are listed from the API at most once, and only if a handle
+// isn't an identifier.
+type resolver struct {
+	Kind     string
+	Prefixes []string
+	List     func() ([]resourceHandle, error)
+	handles  []resourceHandle
+	listed   bool
+}
+
+var identifierPattern = regexp.MustCompile(`^[a-z]{3}-[a-z0-9]{5}$`)
+
+func (r *resolver) isIdentifier(handle string) bool {
+	if !identifierPattern.MatchString(handle) {
+		return false
+	}
+	for _, prefix := range r.Prefixes {
+		if strings.HasPrefix(handle, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *resolver) resolve(handle string) (string, error) {
+	if handle == "" || r.isIdentifier(handle) {
+		return handle, nil
+	}
+	if !r.listed {
+		handles, err := r.List()
+		if err != nil {
+			return "", err
+		}
+		r.handles = handles
+		r.listed = true
+	}
+
+	var matches []resourceHandle
+	for _, h := range r.handles {
+		for _, name := range h.Names {
+			if name != "" && name == handle {
+				matches = append(matches, h)
+				break
+			}
+		}
+	}
+	if len(matches) == 0 {
+		for _, h := range r.handles {
+			if len(h.Names) > 0 && strings.HasPrefix(h.Names[0], handle) {
+				matches = append(matches, h)
+			}
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("No %s found matching '%s'", r.Kind, handle)
+	case 1:
+		return matches[0].Id, nil
+	}
+	ms := make([]string, len(matches))
+	for i, m := range matches {
+		ms[i] = fmt.Sprintf("%s (%s)", m.Id, m.Names[0])
+	}
+	return "", fmt.Errorf("Ambiguous %s '%s', it matches: %s", r.Kind, handle, strings.Join(ms, ", "))
+}
+
+func (r *resolver) resolveAll(handles []string) ([]string, error) {
+	ids := make([]string, len(handles))
+	for i, handle := range handles {
+		id, err := r.resolve(handle)
+		if err != nil {
+			return nil, err
+		}
+		ids[i] = id
+	}
+	return ids, nil
+}
+
+func (c *Client) serverResolver() *resolver {
+	return &resolver{Kind: "server", Prefixes: []string{"srv-"}, List: c.serverHandles}
+}
+
+func (c *Client) serverHandles() ([]resourceHandle, error) {
+	servers, err := c.Servers()
+	if err != nil {
+		return nil, err
+	}
+	var handles []resourceHandle
+	for _, s := range servers {
+		if s.Status == "deleted" {
+			continue
+		}
+		names := []string{s.Name, s.Hostname}
+		if s.Fqdn != "" {
+			names = append(names, s.Fqdn, "public."+s.Fqdn, "ipv6."+s.Fqdn)
+		}
+		handles = append(handles, resourceHandle{s.Id, names})
+	}
+	return handles, nil
+}
+
+func (c *Client) serverGroupResolver() *resolver {
+	return &resolver{Kind: "server group", Prefixes: []string{"grp-"}, List: c.serverGroupHandles}
+}
+
+func (c *Client) serverGroupHandles() ([]resourceHandle, error) {
+	groups, err := c.ServerGroups()
+	if err != nil {
+		return nil, err
+	}
+	var handles []resourceHandle
+	for _, g := range groups {
+		handles = append(handles, resourceHandle{g.Id, []string{g.Name, g.Fqdn}})
+	}
+	return handles, nil
+}
+
+func (c *Client) cloudIPResolver() *resolver {
+	return &resolver{Kind: "Cloud IP", Prefixes: []string{"cip-"}, List: c.cloudIPHandles}
+}
+
+func (c *Client) cloudIPHandles() ([]resourceHandle, error) {
+	cloudIPs, err := c.CloudIPs()
+	if err != nil {
+		return nil, err
+	}
+	var handles []resourceHandle
+	for _, cip := range cloudIPs {
+		handles = append(handles, resourceHandle{cip.Id, []string{cip.Name, cip.PublicIP, cip.Fqdn}})
+	}
+	return handles, nil
+}
+
+func (c *Client) imageResolver() *resolver {
+	return &resolver{Kind: "image", Prefixes: []string{"img-"}, List: c.imageHandles}
+}
+
+func (c *Client) imageHandles() ([]resourceHandle, error) {
+	images, err := c.Images()
+	if err != nil {
+		return nil, err
+	}
+	var handles []resourceHandle
+	for _, i := range images {
+		if i.Status == "deleted" {
+			continue
+		}
+		handles = append(handles, resourceHandle{i.Id, []string{i.Name}})
+	}
+	return handles, nil
+}
+
+func (c *Client) loadBalancerResolver() *resolver {
+	return &resolver{Kind: "load balancer", Prefixes: []string{"lba-"}, List: c.loadBalancerHandles}
+}
+
+func (c *Client) loadBalancerHandles() ([]resourceHandle, error) {
+	lbs, err := c.LoadBalancers()
+	if err != nil {
+		return nil, err
+	}
+	var handles []resourceHandle
+	for _, lb := range lbs {
+		if lb.Status == "deleted" {
+			continue
+		}
+		handles = append(handles, resourceHandle{lb.Id, []string{lb.Name}})
+	}
+	return handles, nil
+}
+
+func (c *Client) databaseServerResolver() *resolver {
+	return &resolver{Kind: "database server", Prefixes: []string{"dbs-"}, List: c.databaseServerHandles}
+}
+
+func (c *Client) databaseServerHandles() ([]resourceHandle, error) {
+	dbss, err := c.DatabaseServers()
+	if err != nil {
+		return nil, err
+	}
+	var handles []resourceHandle
+	for _, dbs := range dbss {
+		if dbs.Status == "deleted" {
+			continue
+		}
+		handles = append(handles, resourceHandle{dbs.Id, []string{dbs.Name}})
+	}
+	return handles, nil
+}
+
+func (c *Client) databaseSnapshotResolver() *resolver {
+	return &resolver{Kind: "database snapshot", Prefixes: []string{"dbi-"}, List: c.databaseSnapshotHandles}
+}
+
+func (c *Client) databaseSnapshotHandles() ([]resourceHandle, error) {
+	snapshots, err := c.DatabaseSnapshots()
+	if err != nil {
+		return nil, err
+	}
+	var handles []resourceHandle
+	for _, s := range snapshots {
+		if s.Status == "deleted" {
+			continue
+		}
+		handles = append(handles, resourceHandle{s.Id, []string{s.Name}})
+	}
+	return handles, nil
+}
+
+func (c *Client) firewallPolicyResolver() *resolver {
+	return &resolver{Kind: "firewall policy", Prefixes: []string{"fwp-"}, List: c.firewallPolicyHandles}
+}
+
+func (c *Client) firewallPolicyHandles() ([]resourceHandle, error) {
+	policies, err := c.FirewallPolicies()
+	if err != nil {
+		return nil, err
+	}
+	var handles []resourceHandle
+	for _, p := range policies {
+		handles = append(handles, resourceHandle{p.Id, []string{p.Name}})
+	}
+	return handles, nil
+}
+
+func (c *Client) accountResolver() *resolver {
+	return &resolver{Kind: "account", Prefixes: []string{"acc-"}, List: c.accountHandles}
+}
+
+func (c *Client) accountHandles() ([]resourceHandle, error) {
+	accounts, err := c.Accounts()
+	if err != nil {
+		return nil, err
+	}
+	var handles []resourceHandle
+	for _, a := range accounts {
+		handles = append(handles, resourceHandle{a.Id, []string{a.Name}})
+	}
+	return handles, nil
+}
@@ -0,0 +1,81 @@
+package cli
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testServerResolver(calls *int) *resolver {
+	return &resolver{Kind: "server", Prefixes: []string{"srv-"}, List: func() ([]resourceHandle, error) {
+		*calls++
+		return []resourceHandle{
+			{"srv-aaaaa", []string{"web-1", "srv-aaaaa", "srv-aaaaa.gb1.brightbox.com"}},
+			{"srv-bbbbb", []string{"web-2", "srv-bbbbb"}},
+			{"srv-ccccc", []string{"db", "srv-ccccc"}},
+			{"srv-ddddd", []string{"", "srv-ddddd"}},
+		}, nil
+	}}
+}
+
+func TestResolverResolve(t *testing.T) {
+	tests := []struct {
+		handle string
+		want   string
+		err    string
+	}{
+		{"", "", ""},
+		{"srv-zzzzz", "srv-zzzzz", ""},
+		{"web-1", "srv-aaaaa", ""},
+		{"srv-bbbbb", "srv-bbbbb", ""},
+		{"srv-aaaaa.gb1.brightbox.com", "srv-aaaaa", ""},
+		{"d", "srv-ccccc", ""},
+		{"web", "", "Ambiguous server 'web', it matches: srv-aaaaa (web-1), srv-bbbbb (web-2)"},
+		{"app", "", "No server found matching 'app'"},
+		{"grp-aaaaa", "", "No server found matching 'grp-aaaaa'"},
+	}
+	for _, test := range tests {
+		calls := 0
+		got, err := testServerResolver(&calls).resolve(test.handle)
+		switch {
+		case test.err != "" && (err == nil || err.Error() != test.err):
+			t.Errorf("%q: got error %v, want %q", test.handle, err, test.err)
+		case test.err == "" && err != nil:
+			t.Errorf("%q: unexpected error: %s", test.handle, err)
+		case got != test.want:
+			t.Errorf("%q: got %q, want %q", test.handle, got, test.want)
+		}
+	}
+}
+
+func TestResolverListsOnlyWhenNeeded(t *testing.T) {
+	calls := 0
+	r := testServerResolver(&calls)
+	if _, err := r.resolveAll([]string{"srv-aaaaa", "srv-bbbbb"}); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 0 {
+		t.Errorf("identifiers listed servers %d times, want 0", calls)
+	}
+	ids, err := r.resolveAll([]string{"web-1", "db", "srv-bbbbb"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"srv-aaaaa", "srv-ccccc", "srv-bbbbb"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("got %v, want %v", ids, want)
+	}
+	if calls != 1 {
+		t.Errorf("listed servers %d times, want 1", calls)
+	}
+}
+
+func TestResolverListError(t *testing.T) {
+	r := &resolver{Kind: "server", Prefixes: []string{"srv-"}, List: func() ([]resourceHandle, error) {
+		return nil, errors.New("API unavailable")
+	}}
+	_, err := r.resolveAll([]string{"srv-aaaaa", "web-1"})
+	if err == nil || !strings.Contains(err.Error(), "API unavailable") {
+		t.Errorf("got error %v, want the list error", err)
+	}
+}
@@ -7,6 +7,11 @@ import (
 	"strings"
 )
 
+var (
+	defaultServerGroupListFields = []string{"id", "server_count", "fwpolicy", "name"}
+	defaultServerGroupShowFields = []string{"id", "name", "default", "servers", "firewall_policy", "description"}
+)
+
 type serverGroupsCommand struct {
 	*CLIApp
 	Id          string
@@ -14,6 +19,26 @@ type serverGroupsCommand struct {
 	IdList      []string
 	Name        *string
 	Description *string
+	Fields      string
+}
+
+func serverGroupFields(g *brightbox.ServerGroup) map[string]string {
+	var policy string
+	if g.FirewallPolicy != nil {
+		policy = g.FirewallPolicy.Id
+	}
+	return map[string]string{
+		"id":              g.Id,
+		"name":            g.Name,
+		"default":         formatBool(g.Default),
+		"created_at":      formatTime(g.CreatedAt),
+		"fqdn":            g.Fqdn,
+		"servers":         collectById(g.Servers),
+		"server_count":    formatInt(len(g.Servers)),
+		"fwpolicy":        policy,
+		"firewall_policy": policy,
+		"description":     g.Description,
+	}
 }
 
 func (l *serverGroupsCommand) list(pc *kingpin.ParseContext) error {
@@ -21,18 +46,20 @@ func (l *serverGroupsCommand) list(pc *kingpin.ParseContext) error {
 	if err != nil {
 		return err
 	}
+	out, err := l.rowOutput(l.Fields)
+	if err != nil {
+		return err
+	}
 	groups, err := l.Client.ServerGroups()
 	if err != nil {
 		return err
 	}
-	w := tabWriter()
-	defer w.Flush()
-	listRec(w, "ID", "SERVER_COUNT", "FWPOLICY", "NAME")
-	for _, s := range groups {
-		listRec(
-			w, s.Id, len(s.Servers), s.FirewallPolicy.Id, s.Name)
+	for _, g := range groups {
+		if err = out.Write(serverGroupFields(&g), g); err != nil {
+			return err
+		}
 	}
-	return nil
+	return out.Flush()
 }
 
 func (l *serverGroupsCommand) show(pc *kingpin.ParseContext) error {
@@ -40,22 +67,22 @@ func (l *serverGroupsCommand) show(pc *kingpin.ParseContext) error {
 	if err != nil {
 		return err
 	}
-	w := tabWriterRight()
-	defer w.Flush()
+	l.Id, err = l.Client.serverGroupResolver().resolve(l.Id)
+	if err != nil {
+		return err
+	}
+	out, err := l.showOutput(l.Fields)
+	if err != nil {
+		return err
+	}
 	g, err := l.Client.ServerGroup(l.Id)
 	if err != nil {
 		l.Fatalf(err.Error())
 	}
-
-	drawShow(w, []interface{}{
-		"id", g.Id,
-		"name", g.Name,
-		"default", g.Default,
-		"servers", collectById(g.Servers),
-		"firewall_policy", g.FirewallPolicy.Id,
-		"description", g.Description,
-	})
-	return nil
+	if err = out.Write(serverGroupFields(g), g); err != nil {
+		return err
+	}
+	return out.Flush()
 
 }
 
@@ -64,6 +91,10 @@ func (l *serverGroupsCommand) create(pc *kingpin.ParseContext) error {
 	if err != nil {
 		return err
 	}
+	out, err := l.rowOutput(l.Fields)
+	if err != nil {
+		return err
+	}
 	newGroup := brightbox.ServerGroupOptions{
 		Name:        l.Name,
 		Description: l.Description,
@@ -73,12 +104,10 @@ func (l *serverGroupsCommand) create(pc *kingpin.ParseContext) error {
 	if err != nil {
 		return err
 	}
-	w := tabWriter()
-	defer w.Flush()
-	listRec(w, "ID", "SERVER_COUNT", "FWPOLICY", "NAME")
-	listRec(
-		w, group.Id, len(group.Servers), group.FirewallPolicy.Id, group.Name)
-	return nil
+	if err = out.Write(serverGroupFields(group), group); err != nil {
+		return err
+	}
+	return out.Flush()
 }
 
 func (l *serverGroupsCommand) update(pc *kingpin.ParseContext) error {
@@ -86,6 +115,14 @@ func (l *serverGroupsCommand) update(pc *kingpin.ParseContext) error {
 	if err != nil {
 		return err
 	}
+	l.Id, err = l.Client.serverGroupResolver().resolve(l.Id)
+	if err != nil {
+		return err
+	}
+	out, err := l.rowOutput(l.Fields)
+	if err != nil {
+		return err
+	}
 	updateGroup := brightbox.ServerGroupOptions{
 		Id:          l.Id,
 		Name:        l.Name,
@@ -95,12 +132,10 @@ func (l *serverGroupsCommand) update(pc *kingpin.ParseContext) error {
 	if err != nil {
 		return err
 	}
-	w := tabWriter()
-	defer w.Flush()
-	listRec(w, "ID", "SERVER_COUNT", "FWPOLICY", "NAME")
-	listRec(
-		w, group.Id, len(group.Servers), group.FirewallPolicy.Id, group.Name)
-	return nil
+	if err = out.Write(serverGroupFields(group), group); err != nil {
+		return err
+	}
+	return out.Flush()
 }
 
 func (l *serverGroupsCommand) destroy(pc *kingpin.ParseContext) error {
@@ -108,6 +143,10 @@ func (l *serverGroupsCommand) destroy(pc *kingpin.ParseContext) error {
 	if err != nil {
 		return err
 	}
+	l.IdList, err = l.Client.serverGroupResolver().resolveAll(l.IdList)
+	if err != nil {
+		return err
+	}
 	returnError := false
 	for _, id := range l.IdList {
 		fmt.Printf("Destroying server group %s\n", id)
@@ -128,6 +167,14 @@ func (l *serverGroupsCommand) add(pc *kingpin.ParseContext) error {
 	if err != nil {
 		return err
 	}
+	l.Id, err = l.Client.serverGroupResolver().resolve(l.Id)
+	if err != nil {
+		return err
+	}
+	l.IdList, err = l.Client.serverResolver().resolveAll(l.IdList)
+	if err != nil {
+		return err
+	}
 	fmt.Printf("Adding servers %s to server group %s\n", strings.Join(l.IdList, ", "), l.Id)
 	_, err = l.Client.AddServersToServerGroup(l.Id, l.IdList)
 	if err != nil {
@@ -141,6 +188,14 @@ func (l *serverGroupsCommand) remove(pc *kingpin.ParseContext) error {
 	if err != nil {
 		return err
 	}
+	l.Id, err = l.Client.serverGroupResolver().resolve(l.Id)
+	if err != nil {
+		return err
+	}
+	l.IdList, err = l.Client.serverResolver().resolveAll(l.IdList)
+	if err != nil {
+		return err
+	}
 	fmt.Printf("Removing servers %s to server group %s\n", strings.Join(l.IdList, ", "), l.Id)
 	_, err = l.Client.RemoveServersFromServerGroup(l.Id, l.IdList)
 	if err != nil {
@@ -154,6 +209,18 @@ func (l *serverGroupsCommand) move(pc *kingpin.ParseContext) error {
 	if err != nil {
 		return err
 	}
+	l.Id, err = l.Client.serverGroupResolver().resolve(l.Id)
+	if err != nil {
+		return err
+	}
+	l.Dst, err = l.Client.serverGroupResolver().resolve(l.Dst)
+	if err != nil {
+		return err
+	}
+	l.IdList, err = l.Client.serverResolver().resolveAll(l.IdList)
+	if err != nil {
+		return err
+	}
 	fmt.Printf("Moving servers %s from server group %s to server group %s\n", strings.Join(l.IdList, ", "), l.Dst, l.Id)
 	_, err = l.Client.MoveServersToServerGroup(l.Id, l.Dst, l.IdList)
 	if err != nil {
@@ -165,16 +232,26 @@ func (l *serverGroupsCommand) move(pc *kingpin.ParseContext) error {
 func configureServerGroupsCommand(app *CLIApp) {
 	cmd := serverGroupsCommand{CLIApp: app}
 	groups := app.Command("groups", "manage server groups")
-	groups.Command("list", "list server groups").
+	list := groups.Command("list", "list server groups").
 		Default().Action(cmd.list)
+	app.listFlags(list)
+	list.Flag("fields", "Which fields to display").
+		Default(strings.Join(defaultServerGroupListFields, ",")).
+		StringVar(&cmd.Fields)
 
 	show := groups.Command("show", "View details of a server group").
 		Action(cmd.show)
-	show.Arg("identifier", "id of server group to show").
+	show.Arg("identifier", "Identifier or name of server group to show").
 		StringVar(&cmd.Id)
+	show.Flag("fields", "Which fields to display").
+		Default(strings.Join(defaultServerGroupShowFields, ",")).
+		StringVar(&cmd.Fields)
 
 	create := groups.Command("create", "Create a new server group").
 		Action(cmd.create)
+	create.Flag("fields", "Which fields to display").
+		Default(strings.Join(defaultServerGroupListFields, ",")).
+		StringVar(&cmd.Fields)
 	create.Flag("name", "Name to give the new server group").
 		Short('n').SetValue(&pStringValue{&cmd.Name})
 	create.Flag("description", "Description to give the new server group").
@@ -182,8 +259,11 @@ func configureServerGroupsCommand(app *CLIApp) {
 
 	update := groups.Command("update", "Update a new server group").
 		Action(cmd.update)
-	update.Arg("identifier", "id of server group to update").
+	update.Arg("identifier", "Identifier or name of server group to update").
 		Required().StringVar(&cmd.Id)
+	update.Flag("fields", "Which fields to display").
+		Default(strings.Join(defaultServerGroupListFields, ",")).
+		StringVar(&cmd.Fields)
 	update.Flag("name", "Set a new name for the server group").
 		Short('n').SetValue(&pStringValue{&cmd.Name})
 	update.Flag("description", "Set a new description for the server group").
@@ -191,30 +271,30 @@ func configureServerGroupsCommand(app *CLIApp) {
 
 	destroy := groups.Command("destroy", "Destroy a server group").
 		Action(cmd.destroy)
-	destroy.Arg("identifier", "Identifier of server groupto destroy").
+	destroy.Arg("identifier", "Identifier or name of server groupto destroy").
 		Required().StringsVar(&cmd.IdList)
 
 	add := groups.Command("add_servers", "Add servers to a server group").
 		Action(cmd.add)
-	add.Arg("group_identifier", "Identifier of group to add the servers to").
+	add.Arg("group_identifier", "Identifier or name of group to add the servers to").
 		Required().StringVar(&cmd.Id)
-	add.Arg("server_identifiers", "Identifiers of servers to add to the group").
+	add.Arg("server_identifiers", "Identifiers or names of servers to add to the group").
 		Required().StringsVar(&cmd.IdList)
 
 	rem := groups.Command("remove_servers", "Remove servers from a server group").
 		Action(cmd.remove)
-	rem.Arg("group_identifier", "Identifier of group to remove the servers from").
+	rem.Arg("group_identifier", "Identifier or name of group to remove the servers from").
 		Required().StringVar(&cmd.Id)
-	rem.Arg("server_identifiers", "Identifiers of servers to remove from the group").
+	rem.Arg("server_identifiers", "Identifiers or names of servers to remove from the group").
 		Required().StringsVar(&cmd.IdList)
 
 	mv := groups.Command("move_servers", "Move servers between server groups").
 		Action(cmd.move)
-	mv.Arg("src_group_identifier", "Identifier of group to move the servers from").
+	mv.Arg("src_group_identifier", "Identifier or name of group to move the servers from").
 		Required().StringVar(&cmd.Id)
-	mv.Arg("dst_group_identifier", "Identifier of group to move the servers to").
+	mv.Arg("dst_group_identifier", "Identifier or name of group to move the servers to").
 		Required().StringVar(&cmd.Dst)
-	mv.Arg("server_identifiers", "Identifiers of servers to move").
+	mv.Arg("server_identifiers", "Identifiers or names of servers to move").
 		Required().StringsVar(&cmd.IdList)
 
 }
@@ -20,6 +20,7 @@ var (
 
 type serversCommand struct {
 	*CLIApp
+	waitOptions
 	All               bool
 	Id                string
 	IdList            []string
@@ -33,6 +34,12 @@ type serversCommand struct {
 	Base64            bool
 	CompatibilityMode *bool
 	Fields            string
+	User              string
+	Print             bool
+	Command           []string
+	Jumps             map[string]string
+	UpdateFile        string
+	Section           string
 }
 
 func serverFields(s brightbox.Server) map[string]string {
@@ -74,19 +81,22 @@ func (l *serversCommand) list(pc *kingpin.ParseContext) error {
 	if err != nil {
 		return err
 	}
+	out, err := l.rowOutput(l.Fields)
+	if err != nil {
+		return err
+	}
 
 	var groupFilter []string
 	if l.Groups != nil {
-		groupFilter = strings.Split(*l.Groups, ",")
+		groupFilter, err = l.Client.serverGroupResolver().resolveAll(strings.Split(*l.Groups, ","))
+		if err != nil {
+			return err
+		}
 	}
 	servers, err := l.Client.Servers()
 	if err != nil {
 		return err
 	}
-	out := new(RowFieldOutput)
-	out.Setup(strings.Split(l.Fields, ","))
-
-	out.SendHeader()
 	for _, s := range servers {
 		if len(groupFilter) > 0 {
 			matches := 0
@@ -101,13 +111,12 @@ func (l *serversCommand) list(pc *kingpin.ParseContext) error {
 				continue
 			}
 		}
-		if err = out.Write(serverFields(s)); err != nil {
+		if err = out.Write(serverFields(s), s); err != nil {
 			return err
 		}
 
 	}
-	out.Flush()
-	return nil
+	return out.Flush()
 }
 
 func (l *serversCommand) show(pc *kingpin.ParseContext) error {
@@ -115,18 +124,22 @@ func (l *serversCommand) show(pc *kingpin.ParseContext) error {
 	if err != nil {
 		return err
 	}
+	l.Id, err = l.Client.serverResolver().resolve(l.Id)
+	if err != nil {
+		return err
+	}
+	out, err := l.showOutput(l.Fields)
+	if err != nil {
+		return err
+	}
 	s, err := l.Client.Server(l.Id)
 	if err != nil {
 		l.Fatalf(err.Error())
 	}
-	out := new(ShowFieldOutput)
-	out.Setup(strings.Split(l.Fields, ","))
-
-	if err = out.Write(serverFields(*s)); err != nil {
+	if err = out.Write(serverFields(*s), s); err != nil {
 		return err
 	}
-	out.Flush()
-	return nil
+	return out.Flush()
 
 }
 
@@ -135,6 +148,14 @@ func (l *serversCommand) create(pc *kingpin.ParseContext) error {
 	if err != nil {
 		return err
 	}
+	l.ImageId, err = l.Client.imageResolver().resolve(l.ImageId)
+	if err != nil {
+		return err
+	}
+	out, err := l.showOutput(l.Fields)
+	if err != nil {
+		return err
+	}
 	newServer := brightbox.ServerOptions{
 		Image: l.ImageId,
 		Name:  l.Name,
@@ -159,6 +180,10 @@ func (l *serversCommand) create(pc *kingpin.ParseContext) error {
 	if l.Groups != nil {
 		groups := strings.Split(*l.Groups, ",")
 		if len(groups) > 1 || (len(groups) == 1 && groups[0] != "") {
+			groups, err = l.Client.serverGroupResolver().resolveAll(groups)
+			if err != nil {
+				return err
+			}
 			newServer.ServerGroups = groups
 		}
 	}
@@ -198,14 +223,21 @@ func (l *serversCommand) create(pc *kingpin.ParseContext) error {
 		return err
 	}
 
-	out := new(ShowFieldOutput)
-	out.Setup(strings.Split(l.Fields, ","))
-
-	if err = out.Write(serverFields(*server)); err != nil {
+	var waitErr error
+	if l.Wait {
+		fmt.Fprintf(os.Stderr, "Waiting for server %s to be active\n", server.Id)
+		waitErr = waitForStatus("Server "+server.Id, l.Timeout, l.Client.serverStatus(server.Id), "active")
+		if s, err := l.Client.Server(server.Id); err == nil {
+			server = s
+		}
+	}
+	if err = out.Write(serverFields(*server), server); err != nil {
 		return err
 	}
-	out.Flush()
-	return nil
+	if err = out.Flush(); err != nil {
+		return err
+	}
+	return waitErr
 
 }
 
@@ -214,6 +246,14 @@ func (l *serversCommand) update(pc *kingpin.ParseContext) error {
 	if err != nil {
 		return err
 	}
+	l.IdList, err = l.Client.serverResolver().resolveAll(l.IdList)
+	if err != nil {
+		return err
+	}
+	out, err := l.rowOutput(l.Fields)
+	if err != nil {
+		return err
+	}
 	updateServer := brightbox.ServerOptions{Id: l.Id}
 
 	updateServer.Name = l.Name
@@ -221,6 +261,10 @@ func (l *serversCommand) update(pc *kingpin.ParseContext) error {
 	if l.Groups != nil {
 		groups := strings.Split(*l.Groups, ",")
 		if len(groups) > 1 || (len(groups) == 1 && groups[0] != "") {
+			groups, err = l.Client.serverGroupResolver().resolveAll(groups)
+			if err != nil {
+				return err
+			}
 			updateServer.ServerGroups = groups
 		}
 	}
@@ -257,10 +301,6 @@ func (l *serversCommand) update(pc *kingpin.ParseContext) error {
 		return fmt.Errorf("User data cannot exceed 16k")
 	}
 
-	out := new(RowFieldOutput)
-	out.Setup(strings.Split(l.Fields, ","))
-	out.SendHeader()
-
 	returnError := false
 	for _, id := range l.IdList {
 
@@ -276,21 +316,45 @@ func (l *serversCommand) update(pc *kingpin.ParseContext) error {
 			continue
 		}
 		if server != nil {
-			out.Write(serverFields(*server))
+			out.Write(serverFields(*server), server)
 		}
 	}
-	out.Flush()
+	if err = out.Flush(); err != nil {
+		return err
+	}
 	if returnError {
 		return errGeneric
 	}
 	return nil
 }
 
+// waitForServers waits for each of the servers to reach the status, if --wait
+// was given, reporting any that don't. It returns false if any didn't.
+func (l *serversCommand) waitForServers(ids []string, status string) bool {
+	if !l.Wait {
+		return true
+	}
+	ok := true
+	for _, id := range ids {
+		fmt.Fprintf(os.Stderr, "Waiting for server %s to be %s\n", id, status)
+		err := waitForStatus("Server "+id, l.Timeout, l.Client.serverStatus(id), status)
+		if err != nil {
+			l.Errorf("%s", err.Error())
+			ok = false
+		}
+	}
+	return ok
+}
+
 func (l *serversCommand) destroy(pc *kingpin.ParseContext) error {
 	err := l.Configure()
 	if err != nil {
 		return err
 	}
+	l.IdList, err = l.Client.serverResolver().resolveAll(l.IdList)
+	if err != nil {
+		return err
+	}
 	returnError := false
 	for _, id := range l.IdList {
 		fmt.Printf("Destroying server %s\n", id)
@@ -311,7 +375,12 @@ func (l *serversCommand) stop(pc *kingpin.ParseContext) error {
 	if err != nil {
 		return err
 	}
+	l.IdList, err = l.Client.serverResolver().resolveAll(l.IdList)
+	if err != nil {
+		return err
+	}
 	returnError := false
+	var done []string
 	for _, id := range l.IdList {
 		fmt.Printf("Stopping server %s\n", id)
 		err := l.Client.StopServer(id)
@@ -321,7 +390,12 @@ func (l *serversCommand) stop(pc *kingpin.ParseContext) error {
 			}
 			l.Errorf("%s: %s", err.Error(), id)
 			returnError = true
+			continue
 		}
+		done = append(done, id)
+	}
+	if !l.waitForServers(done, "inactive") {
+		returnError = true
 	}
 	if returnError {
 		return errGeneric
@@ -334,7 +408,12 @@ func (l *serversCommand) start(pc *kingpin.ParseContext) error {
 	if err != nil {
 		return err
 	}
+	l.IdList, err = l.Client.serverResolver().resolveAll(l.IdList)
+	if err != nil {
+		return err
+	}
 	returnError := false
+	var done []string
 	for _, id := range l.IdList {
 		fmt.Printf("Starting server %s\n", id)
 		err := l.Client.StartServer(id)
@@ -344,7 +423,12 @@ func (l *serversCommand) start(pc *kingpin.ParseContext) error {
 			}
 			l.Errorf("%s: %s", err.Error(), id)
 			returnError = true
+			continue
 		}
+		done = append(done, id)
+	}
+	if !l.waitForServers(done, "active") {
+		returnError = true
 	}
 	if returnError {
 		return errGeneric
@@ -357,6 +441,10 @@ func (l *serversCommand) reboot(pc *kingpin.ParseContext) error {
 	if err != nil {
 		return err
 	}
+	l.IdList, err = l.Client.serverResolver().resolveAll(l.IdList)
+	if err != nil {
+		return err
+	}
 	returnError := false
 	for _, id := range l.IdList {
 		fmt.Printf("Rebooting server %s\n", id)
@@ -380,6 +468,10 @@ func (l *serversCommand) reset(pc *kingpin.ParseContext) error {
 	if err != nil {
 		return err
 	}
+	l.IdList, err = l.Client.serverResolver().resolveAll(l.IdList)
+	if err != nil {
+		return err
+	}
 	returnError := false
 	for _, id := range l.IdList {
 		fmt.Printf("Resetting server %s\n", id)
@@ -403,7 +495,12 @@ func (l *serversCommand) shutdown(pc *kingpin.ParseContext) error {
 	if err != nil {
 		return err
 	}
+	l.IdList, err = l.Client.serverResolver().resolveAll(l.IdList)
+	if err != nil {
+		return err
+	}
 	returnError := false
+	var done []string
 	for _, id := range l.IdList {
 		fmt.Printf("Shutting down server %s\n", id)
 		err := l.Client.ShutdownServer(id)
@@ -413,7 +510,12 @@ func (l *serversCommand) shutdown(pc *kingpin.ParseContext) error {
 			}
 			l.Errorf("%s: %s", err.Error(), id)
 			returnError = true
+			continue
 		}
+		done = append(done, id)
+	}
+	if !l.waitForServers(done, "inactive") {
+		returnError = true
 	}
 	if returnError {
 		return errGeneric
@@ -426,6 +528,10 @@ func (l *serversCommand) lock(pc *kingpin.ParseContext) error {
 	if err != nil {
 		return err
 	}
+	l.IdList, err = l.Client.serverResolver().resolveAll(l.IdList)
+	if err != nil {
+		return err
+	}
 	returnError := false
 	for _, id := range l.IdList {
 		fmt.Printf("Locking server %s\n", id)
@@ -449,6 +555,10 @@ func (l *serversCommand) unlock(pc *kingpin.ParseContext) error {
 	if err != nil {
 		return err
 	}
+	l.IdList, err = l.Client.serverResolver().resolveAll(l.IdList)
+	if err != nil {
+		return err
+	}
 	returnError := false
 	for _, id := range l.IdList {
 		fmt.Printf("Unlocking server %s\n", id)
@@ -472,7 +582,12 @@ func (l *serversCommand) snapshot(pc *kingpin.ParseContext) error {
 	if err != nil {
 		return err
 	}
+	l.IdList, err = l.Client.serverResolver().resolveAll(l.IdList)
+	if err != nil {
+		return err
+	}
 	returnError := false
+	var images []string
 	for _, id := range l.IdList {
 		fmt.Printf("Snapshotting server %s\n", id)
 		img, err := l.Client.SnapshotServer(id)
@@ -485,6 +600,17 @@ func (l *serversCommand) snapshot(pc *kingpin.ParseContext) error {
 			continue
 		}
 		fmt.Printf("Snapsnot image %s started from server %s\n", img.Id, id)
+		images = append(images, img.Id)
+	}
+	if l.Wait {
+		for _, id := range images {
+			fmt.Fprintf(os.Stderr, "Waiting for image %s to be available\n", id)
+			err := waitForStatus("Image "+id, l.Timeout, l.Client.imageStatus(id), "available")
+			if err != nil {
+				l.Errorf("%s", err.Error())
+				returnError = true
+			}
+		}
 	}
 	if returnError {
 		return errGeneric
@@ -497,6 +623,10 @@ func (l *serversCommand) activateConsole(pc *kingpin.ParseContext) error {
 	if err != nil {
 		return err
 	}
+	l.IdList, err = l.Client.serverResolver().resolveAll(l.IdList)
+	if err != nil {
+		return err
+	}
 	returnError := false
 	for _, id := range l.IdList {
 		fmt.Printf("Activating console for server %s\n", id)
@@ -524,12 +654,13 @@ func configureServersCommand(app *CLIApp) {
 		Default().Action(cmd.list)
 	list.Flag("groups", "List only servers belonging to these groups").
 		Short('g').SetValue(&pStringValue{&cmd.Groups})
+	app.listFlags(list)
 	list.Flag("fields", "Which fields to display").
 		Default(strings.Join(defaultServerListFields, ",")).
 		StringVar(&cmd.Fields)
 	show := servers.Command("show", "View details on a cloud server").
 		Action(cmd.show)
-	show.Arg("identifier", "Identifier of server to show").
+	show.Arg("identifier", "Identifier or name of server to show").
 		Required().StringVar(&cmd.Id)
 	show.Flag("fields", "Which fields to display").
 		Default(strings.Join(defaultServerShowFields, ",")).
@@ -539,7 +670,7 @@ func configureServersCommand(app *CLIApp) {
 	create.Flag("fields", "Which fields to display").
 		Default(strings.Join(defaultServerShowFields, ",")).
 		StringVar(&cmd.Fields)
-	create.Arg("image identifier", "Identifier of image with which to create the server").
+	create.Arg("image identifier", "Identifier or name of image with which to create the server").
 		Required().StringVar(&cmd.ImageId)
 	create.Flag("name", "Name to give the new server").
 		Short('n').SetValue(&pStringValue{&cmd.Name})
@@ -555,10 +686,11 @@ func configureServersCommand(app *CLIApp) {
 		PlaceHolder("FILENAME").OpenFileVar(&cmd.UserDataFile, 0, 0)
 	create.Flag("base64", "Base64 encode the user data (default: true)").
 		Default("true").BoolVar(&cmd.Base64)
+	cmd.waitFlags(create, "active")
 
 	update := servers.Command("update", "Update a cloud server").
 		Action(cmd.update)
-	update.Arg("identifier", "Identifier of servers to update").
+	update.Arg("identifier", "Identifier or name of servers to update").
 		Required().StringsVar(&cmd.IdList)
 	update.Flag("fields", "Which fields to display").
 		Default(strings.Join(defaultServerListFields, ",")).
@@ -578,52 +710,76 @@ func configureServersCommand(app *CLIApp) {
 
 	destroy := servers.Command("destroy", "Destroy a cloud server").
 		Action(cmd.destroy)
-	destroy.Arg("identifier", "Identifier of server to destroy").
+	destroy.Arg("identifier", "Identifier or name of server to destroy").
 		Required().StringsVar(&cmd.IdList)
 
 	stop := servers.Command("stop", "Stop a cloud server").
 		Action(cmd.stop)
-	stop.Arg("identifier", "Identifier of servers to stop").
+	stop.Arg("identifier", "Identifier or name of servers to stop").
 		Required().StringsVar(&cmd.IdList)
+	cmd.waitFlags(stop, "inactive")
 
 	start := servers.Command("start", "Start a cloud server").
 		Action(cmd.start)
-	start.Arg("identifier", "Identifier of servers to start").
+	start.Arg("identifier", "Identifier or name of servers to start").
 		Required().StringsVar(&cmd.IdList)
+	cmd.waitFlags(start, "active")
 
 	reboot := servers.Command("reboot", "Reboot a cloud server").
 		Action(cmd.reboot)
-	reboot.Arg("identifier", "Identifier of servers to reboot").
+	reboot.Arg("identifier", "Identifier or name of servers to reboot").
 		Required().StringsVar(&cmd.IdList)
 
 	reset := servers.Command("reset", "Reset a cloud server").
 		Action(cmd.reset)
-	reset.Arg("identifier", "Identifier of servers to reset").
+	reset.Arg("identifier", "Identifier or name of servers to reset").
 		Required().StringsVar(&cmd.IdList)
 
 	shutdown := servers.Command("shutdown", "Shutdown a cloud server").
 		Action(cmd.shutdown)
-	shutdown.Arg("identifier", "Identifier of servers to shut down").
+	shutdown.Arg("identifier", "Identifier or name of servers to shut down").
 		Required().StringsVar(&cmd.IdList)
+	cmd.waitFlags(shutdown, "inactive")
 
 	lock := servers.Command("lock", "Lock a cloud server").
 		Action(cmd.lock)
-	lock.Arg("identifier", "Identifier of servers to lock").
+	lock.Arg("identifier", "Identifier or name of servers to lock").
 		Required().StringsVar(&cmd.IdList)
 
 	unlock := servers.Command("unlock", "Unlock a cloud server").
 		Action(cmd.unlock)
-	unlock.Arg("identifier", "Identifier of servers to unlock").
+	unlock.Arg("identifier", "Identifier or name of servers to unlock").
 		Required().StringsVar(&cmd.IdList)
 
 	snap := servers.Command("snapshot", "Snapshot a cloud server").
 		Action(cmd.snapshot)
-	snap.Arg("identifier", "Identifier of servers to snapshot").
+	snap.Arg("identifier", "Identifier or name of servers to snapshot").
 		Required().StringsVar(&cmd.IdList)
+	cmd.waitFlags(snap, "available, for the snapshot image")
 
 	console := servers.Command("activate_console", "Activate the graphical console for a cloud server").
 		Action(cmd.activateConsole)
-	console.Arg("identifier", "Identifier of servers to snapshot").
+	console.Arg("identifier", "Identifier or name of servers to snapshot").
 		Required().StringsVar(&cmd.IdList)
 
+	ssh := servers.Command("ssh", "Connect to a cloud server with ssh").
+		Action(cmd.ssh)
+	ssh.Arg("identifier", "Identifier or name of server to connect to").
+		Required().StringVar(&cmd.Id)
+	ssh.Arg("command", "Command to run on the server, after --").
+		StringsVar(&cmd.Command)
+	ssh.Flag("user", "User to log in as (default: the image's username)").
+		Short('u').StringVar(&cmd.User)
+	ssh.Flag("print", "Print the ssh command instead of running it").
+		BoolVar(&cmd.Print)
+
+	sshConfig := servers.Command("ssh-config", "Generate ssh config Host entries for active cloud servers").
+		Action(cmd.writeSSHConfig)
+	sshConfig.Flag("jump", "Connect to servers in a group through a jump host, e.g: --jump frontend=bastion").
+		PlaceHolder("GROUP=HOST").StringMapVar(&cmd.Jumps)
+	sshConfig.Flag("update", "Rewrite the marked section of this ssh config file, rather than printing the entries").
+		PlaceHolder("FILE").StringVar(&cmd.UpdateFile)
+	sshConfig.Flag("section", "Name of the marked section to rewrite with --update").
+		Default("brightbox").StringVar(&cmd.Section)
+
 }
@@ -0,0 +1,123 @@
+package cli
+
+import (
+	"fmt"
+	"github.com/brightbox/gobrightbox"
+	"gopkg.in/alecthomas/kingpin.v2"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"syscall"
+)
+
+// serverSSHAddress picks the best address to reach a server on: a mapped
+// Cloud IP, then its IPv6 address, then its private IPv4 address.
+func serverSSHAddress(s *brightbox.Server) string {
+	for _, cip := range s.CloudIPs {
+		if cip.PublicIP != "" {
+			return cip.PublicIP
+		}
+	}
+	for _, i := range s.Interfaces {
+		if i.IPv6Address != "" {
+			return i.IPv6Address
+		}
+	}
+	for _, i := range s.Interfaces {
+		if i.IPv4Address != "" {
+			return i.IPv4Address
+		}
+	}
+	return ""
+}
+
+// imageUsername returns the username of the image a server was built from.
+// The image embedded in a server doesn't always include it, in which case the
+// image is looked up, using the cache to look up each image only once.
+func (c *Client) imageUsername(s *brightbox.Server, cache map[string]string) string {
+	if s.Image.Username != "" {
+		return s.Image.Username
+	}
+	if username, ok := cache[s.Image.Id]; ok {
+		return username
+	}
+	var username string
+	if img, err := c.Image(s.Image.Id); err == nil {
+		username = img.Username
+	}
+	cache[s.Image.Id] = username
+	return username
+}
+
+var shellSafe = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+
+// shellQuote joins args into a command line that a POSIX shell would split
+// back into the same args
+func shellQuote(args []string) string {
+	quoted := make([]string, len(args))
+	for i, a := range args {
+		if shellSafe.MatchString(a) {
+			quoted[i] = a
+		} else {
+			quoted[i] = "'" + strings.Replace(a, "'", `'\''`, -1) + "'"
+		}
+	}
+	return strings.Join(quoted, " ")
+}
+
+func (l *serversCommand) ssh(pc *kingpin.ParseContext) error {
+	err := l.Configure()
+	if err != nil {
+		return err
+	}
+	l.Id, err = l.Client.serverResolver().resolve(l.Id)
+	if err != nil {
+		return err
+	}
+	s, err := l.Client.Server(l.Id)
+	if err != nil {
+		l.Fatalf(err.Error())
+	}
+	address := serverSSHAddress(s)
+	if address == "" {
+		return fmt.Errorf("Server %s has no address to connect to", s.Id)
+	}
+	user := l.User
+	if user == "" {
+		user = l.Client.imageUsername(s, map[string]string{})
+	}
+	if user != "" {
+		address = user + "@" + address
+	}
+	args := append([]string{"ssh", address}, l.Command...)
+
+	if l.Print {
+		fmt.Println(shellQuote(args))
+		return nil
+	}
+	path, err := exec.LookPath("ssh")
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(path, args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	err = cmd.Run()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
+			return sshExitStatus(status)
+		}
+	}
+	return err
+}
+
+// sshExitStatus is the status to exit with after ssh exits, which is ssh's
+// own, or 255 as ssh uses for its errors if it was killed by a signal
+func sshExitStatus(status syscall.WaitStatus) ExitStatus {
+	if code := status.ExitStatus(); code >= 0 {
+		return ExitStatus(code)
+	}
+	return ExitStatus(255)
+}
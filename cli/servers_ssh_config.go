@@ -0,0 +1,140 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"gopkg.in/alecthomas/kingpin.v2"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+)
+
+// The markers around the section of an ssh config file that --update rewrites
+func sshConfigMarkers(section string) (string, string) {
+	return "# BEGIN " + section, "# END " + section
+}
+
+// sshHostAlias makes a server name usable as an ssh Host alias, which can't
+// contain whitespace
+func sshHostAlias(name string) string {
+	return strings.Join(strings.Fields(name), "-")
+}
+
+// sshConfigHosts builds a Host block for every active server that has an
+// address, in name order. Servers in a server group with a jump host given get
+// a ProxyJump through it, unless they are the jump host.
+func (l *serversCommand) sshConfigHosts() (string, error) {
+	jumps := make(map[string]string)
+	groups := l.Client.serverGroupResolver()
+	for handle, host := range l.Jumps {
+		id, err := groups.resolve(handle)
+		if err != nil {
+			return "", err
+		}
+		jumps[id] = host
+	}
+
+	servers, err := l.Client.Servers()
+	if err != nil {
+		return "", err
+	}
+	sort.SliceStable(servers, func(i, j int) bool {
+		if servers[i].Name != servers[j].Name {
+			return servers[i].Name < servers[j].Name
+		}
+		return servers[i].Id < servers[j].Id
+	})
+
+	var b bytes.Buffer
+	usernames := make(map[string]string)
+	for i := range servers {
+		s := &servers[i]
+		if s.Status != "active" {
+			continue
+		}
+		address := serverSSHAddress(s)
+		if address == "" {
+			continue
+		}
+		aliases := []string{s.Id}
+		if alias := sshHostAlias(s.Name); alias != "" {
+			aliases = []string{alias, s.Id}
+		}
+		fmt.Fprintf(&b, "Host %s\n", strings.Join(aliases, " "))
+		fmt.Fprintf(&b, "  HostName %s\n", address)
+		if user := l.Client.imageUsername(s, usernames); user != "" {
+			fmt.Fprintf(&b, "  User %s\n", user)
+		}
+		for _, g := range s.ServerGroups {
+			jump, ok := jumps[g.Id]
+			if ok && jump != aliases[0] && jump != s.Id {
+				fmt.Fprintf(&b, "  ProxyJump %s\n", jump)
+				break
+			}
+		}
+		b.WriteString("\n")
+	}
+	return b.String(), nil
+}
+
+// replaceSSHConfigSection replaces the marked section of an ssh config with
+// the given Host blocks, adding the section to the end if it isn't there.
+func replaceSSHConfigSection(config, section, blocks string) (string, error) {
+	begin, end := sshConfigMarkers(section)
+	marked := begin + "\n" + blocks + end + "\n"
+
+	lines := strings.SplitAfter(config, "\n")
+	start, finish := -1, -1
+	for i, line := range lines {
+		switch strings.TrimSpace(line) {
+		case begin:
+			if start >= 0 {
+				return "", fmt.Errorf("More than one '%s' line", begin)
+			}
+			start = i
+		case end:
+			if start < 0 {
+				return "", fmt.Errorf("'%s' line before '%s' line", end, begin)
+			}
+			finish = i
+		}
+	}
+	if start >= 0 && finish < 0 {
+		return "", fmt.Errorf("No '%s' line after '%s' line", end, begin)
+	}
+	if start < 0 {
+		if config != "" && !strings.HasSuffix(config, "\n") {
+			config += "\n"
+		}
+		if config != "" {
+			config += "\n"
+		}
+		return config + marked, nil
+	}
+	return strings.Join(lines[:start], "") + marked + strings.Join(lines[finish+1:], ""), nil
+}
+
+func (l *serversCommand) writeSSHConfig(pc *kingpin.ParseContext) error {
+	err := l.Configure()
+	if err != nil {
+		return err
+	}
+	blocks, err := l.sshConfigHosts()
+	if err != nil {
+		return err
+	}
+	if l.UpdateFile == "" {
+		fmt.Print(blocks)
+		return nil
+	}
+	config, err := ioutil.ReadFile(l.UpdateFile)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	updated, err := replaceSSHConfigSection(string(config), l.Section, blocks)
+	if err != nil {
+		return fmt.Errorf("%s: %s", l.UpdateFile, err.Error())
+	}
+	return writeFileAtomically(l.UpdateFile, []byte(updated), 0600)
+}
@@ -0,0 +1,32 @@
+//go:build !windows
+// +build !windows
+
+package cli
+
+import (
+	"os/exec"
+	"syscall"
+	"testing"
+)
+
+func TestSSHExitStatus(t *testing.T) {
+	tests := []struct {
+		command string
+		want    ExitStatus
+	}{
+		{"exit 1", 1},
+		{"exit 255", 255},
+		{"kill -9 $$", 255},
+	}
+	for _, test := range tests {
+		err := exec.Command("sh", "-c", test.command).Run()
+		exitErr, ok := err.(*exec.ExitError)
+		if !ok {
+			t.Errorf("%s: got error %v, want an exit error", test.command, err)
+			continue
+		}
+		if got := sshExitStatus(exitErr.Sys().(syscall.WaitStatus)); got != test.want {
+			t.Errorf("%s: got %d, want %d", test.command, got, test.want)
+		}
+	}
+}
@@ -1,16 +1,30 @@
 package cli
 
 import (
-	"encoding/json"
 	"fmt"
+	"golang.org/x/oauth2"
 	"gopkg.in/alecthomas/kingpin.v2"
+	"strings"
+)
+
+var (
+	defaultTokenShowFields = []string{"access_token", "token_type", "expiry"}
 )
 
 type tokenCommand struct {
 	*CLIApp
 	Id     string
 	Force  bool
-	Format string
+	Fields string
+}
+
+func tokenFields(t *oauth2.Token) map[string]string {
+	return map[string]string{
+		"access_token":  t.AccessToken,
+		"token_type":    t.TokenType,
+		"refresh_token": t.RefreshToken,
+		"expiry":        formatTime(&t.Expiry),
+	}
 }
 
 func (l *tokenCommand) create(pc *kingpin.ParseContext) error {
@@ -18,9 +32,6 @@ func (l *tokenCommand) create(pc *kingpin.ParseContext) error {
 	if err != nil {
 		return err
 	}
-	w := tabWriterRight()
-	defer w.Flush()
-
 	if l.Force {
 		l.Client.TokenCache().Clear()
 	}
@@ -28,23 +39,22 @@ func (l *tokenCommand) create(pc *kingpin.ParseContext) error {
 	if token == nil {
 		l.Fatalf("No cached OAuth token found for %s", l.ClientName)
 	}
-	switch l.Format {
-	case "json":
-		err := json.NewEncoder(w).Encode(token)
-		if err != nil {
-			return err
-		}
-	case "text":
-		drawShow(w, []interface{}{
-			"access_token", token.AccessToken,
-			"token_type", token.TokenType,
-			"expiry", token.Expiry,
-		})
-	case "curl":
-		fmt.Fprintf(w, "curl -H 'Authorization: Bearer %s' %s\n", token.AccessToken, l.Client.ApiUrl)
+	// curl isn't one of the general output formats, so is dealt with here
+	if l.Format == "curl" {
+		fmt.Printf("curl -H 'Authorization: Bearer %s' %s\n", token.AccessToken, l.Client.ApiUrl)
+		return nil
 	}
-
-	return nil
+	out, err := l.showOutput(l.Fields)
+	if err != nil {
+		return err
+	}
+	// Scripts parse the whole token, refresh token and all, so json and yaml
+	// output it as it is rather than just the chosen fields
+	out.Raw = out.Raw || l.Format == "json" || l.Format == "yaml"
+	if err = out.Write(tokenFields(token), token); err != nil {
+		return err
+	}
+	return out.Flush()
 }
 
 func (l *tokenCommand) clear(pc *kingpin.ParseContext) error {
@@ -59,8 +69,10 @@ func (l *tokenCommand) clear(pc *kingpin.ParseContext) error {
 func configureTokenCommand(app *CLIApp) {
 	cmd := tokenCommand{CLIApp: app}
 	token := app.Command("token", "manage oauth tokens")
-	create := token.Command("create", "return a valid token for the client, create one if necessary").Action(cmd.create)
+	create := token.Command("create", "return a valid token for the client, create one if necessary. --format curl outputs a curl command using the token").Action(cmd.create)
 	create.Flag("clear", "clear the local cache first and create a new token").BoolVar(&cmd.Force)
-	create.Flag("format", "the output format: text, json or curl").Default("text").EnumVar(&cmd.Format, "text", "json", "curl")
+	create.Flag("fields", "Which fields to display. json and yaml output always has the whole token.").
+		Default(strings.Join(defaultTokenShowFields, ",")).
+		StringVar(&cmd.Fields)
 	token.Command("clear", "clear the local token cache for this client").Action(cmd.clear)
 }
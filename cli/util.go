@@ -0,0 +1,35 @@
+package cli
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// Write the file through a temporary file in the same directory, so it is
+// never left half written. A symlink is followed, so the file it points to is
+// replaced rather than the link, and an existing file keeps its permissions.
+func writeFileAtomically(filename string, data []byte, perm os.FileMode) error {
+	if resolved, err := filepath.EvalSymlinks(filename); err == nil {
+		filename = resolved
+	}
+	if fi, err := os.Stat(filename); err == nil {
+		perm = fi.Mode().Perm()
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(filename), "."+filepath.Base(filename))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filename)
+}
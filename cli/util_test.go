@@ -0,0 +1,84 @@
+package cli
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFileAtomically(t *testing.T) {
+	dir, err := ioutil.TempDir("", "brightbox-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "config")
+
+	if err = writeFileAtomically(filename, []byte("one\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	assertFile(t, filename, "one\n", 0600)
+
+	// An existing file keeps its permissions
+	if err = os.Chmod(filename, 0640); err != nil {
+		t.Fatal(err)
+	}
+	if err = writeFileAtomically(filename, []byte("two\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	assertFile(t, filename, "two\n", 0640)
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("got %d files, want the temporary file removed", len(entries))
+	}
+}
+
+func TestWriteFileAtomicallyFollowsSymlinks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "brightbox-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	target := filepath.Join(dir, "dotfiles-config")
+	link := filepath.Join(dir, "config")
+	if err = ioutil.WriteFile(target, []byte("old\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Symlink(target, link); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = writeFileAtomically(link, []byte("new\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Lstat(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode()&os.ModeSymlink == 0 {
+		t.Error("the symlink was replaced by a regular file")
+	}
+	assertFile(t, target, "new\n", 0600)
+}
+
+func assertFile(t *testing.T, filename, content string, perm os.FileMode) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != content {
+		t.Errorf("%s has %q, want %q", filename, data, content)
+	}
+	fi, err := os.Stat(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != perm {
+		t.Errorf("%s has mode %s, want %s", filename, fi.Mode().Perm(), perm)
+	}
+}
@@ -0,0 +1,95 @@
+package cli
+
+import (
+	"fmt"
+	"github.com/brightbox/gobrightbox"
+	"gopkg.in/alecthomas/kingpin.v2"
+	"net/http"
+	"time"
+)
+
+// How often to poll the API for the status of a resource being waited on
+var waitPollInterval = 2 * time.Second
+
+// waitOptions holds the --wait and --timeout flags of commands that can wait
+// for resources to reach a status after changing them.
+type waitOptions struct {
+	Wait    bool
+	Timeout time.Duration
+}
+
+func (w *waitOptions) waitFlags(cmd *kingpin.CmdClause, status string) {
+	cmd.Flag("wait", "Wait until the resource is "+status).
+		BoolVar(&w.Wait)
+	cmd.Flag("timeout", "How long to wait before giving up, with --wait").
+		Default("5m").DurationVar(&w.Timeout)
+}
+
+// waitForStatus polls the status of a resource until it is one of wanted.
+// It gives up after the timeout, or straight away if the resource fails or
+// is deleted while something else was wanted. A resource that can't be found
+// any more is taken to be deleted.
+func waitForStatus(desc string, timeout time.Duration, status func() (string, error), wanted ...string) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		current, err := status()
+		if err != nil {
+			if !isNotFound(err) {
+				return err
+			}
+			current = "deleted"
+		}
+		for _, w := range wanted {
+			if current == w {
+				return nil
+			}
+		}
+		if current == "failed" || current == "deleted" {
+			return fmt.Errorf("%s is %s", desc, current)
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%s still %s after %s, giving up", desc, current, timeout)
+		}
+		time.Sleep(waitPollInterval)
+	}
+}
+
+func isNotFound(err error) bool {
+	switch e := err.(type) {
+	case brightbox.ApiError:
+		return e.StatusCode == http.StatusNotFound
+	case *brightbox.ApiError:
+		return e.StatusCode == http.StatusNotFound
+	}
+	return false
+}
+
+func (c *Client) serverStatus(id string) func() (string, error) {
+	return func() (string, error) {
+		s, err := c.Server(id)
+		if err != nil {
+			return "", err
+		}
+		return s.Status, nil
+	}
+}
+
+func (c *Client) imageStatus(id string) func() (string, error) {
+	return func() (string, error) {
+		i, err := c.Image(id)
+		if err != nil {
+			return "", err
+		}
+		return i.Status, nil
+	}
+}
+
+func (c *Client) cloudIPStatus(id string) func() (string, error) {
+	return func() (string, error) {
+		cip, err := c.CloudIP(id)
+		if err != nil {
+			return "", err
+		}
+		return cip.Status, nil
+	}
+}
@@ -0,0 +1,13 @@
+#!/bin/sh
+#
+# Ansible dynamic inventory of Brightbox cloud servers. Ansible runs inventory
+# scripts with just --list or --host NAME, so this passes those on to
+# "inventory ansible".
+#
+#   $ CLIENT=cli-xxxxx ansible -i contrib/ansible_inventory.sh all -m ping
+#
+# CLIENT and ACCOUNT choose the API client and account, as they do for the CLI
+# itself. BRIGHTBOX_CLI is the CLI to run, if it isn't gobrightbox-cli on the
+# PATH.
+
+exec "${BRIGHTBOX_CLI:-gobrightbox-cli}" inventory ansible "$@"
@@ -0,0 +1,443 @@
+// Package fakeapi serves an in-memory imitation of the parts of the Brightbox
+// API used by the cli, along with the OAuth /token endpoint, so the cli can
+// be used and tested offline.
+//
+// Any client credentials are accepted. Changes take effect at once: new
+// servers are active straight away, and destroyed resources are gone.
+package fakeapi
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AccountId is the identifier of the one account the fake API holds
+const AccountId = "acc-fake1"
+
+const tokenLifetime = 2 * time.Hour
+
+// resource is an API resource as stored. Fields referring to other resources
+// hold their identifiers, and are expanded when rendered. Fields starting
+// with an underscore are never rendered.
+type resource map[string]interface{}
+
+// apiError is a failed request, rendered as the API renders errors
+type apiError struct {
+	Status int
+	Name   string
+	Errors []string
+}
+
+func (e *apiError) Error() string {
+	return strings.Join(e.Errors, ", ")
+}
+
+func errorf(status int, name string, format string, args ...interface{}) *apiError {
+	return &apiError{Status: status, Name: name, Errors: []string{fmt.Sprintf(format, args...)}}
+}
+
+// Server is a fake API. It is an http.Handler, so can be run with
+// http.ListenAndServe or httptest.NewServer.
+type Server struct {
+	mu        sync.Mutex
+	seq       int
+	tokens    map[string]time.Time
+	resources map[string]map[string]resource
+}
+
+// New returns a fake API holding one account, with the zones, server types,
+// image, server group and firewall policy a new account would have.
+func New() *Server {
+	s := &Server{
+		tokens:    make(map[string]time.Time),
+		resources: make(map[string]map[string]resource),
+	}
+	for name := range kinds {
+		s.resources[name] = make(map[string]resource)
+	}
+	s.seed()
+	return s
+}
+
+// nextId returns a new identifier with a prefix. Identifiers are sequential,
+// so resources list in the order they were created.
+func (s *Server) nextId(prefix string) string {
+	s.seq++
+	id := strconv.FormatInt(int64(s.seq), 36)
+	return prefix + "-" + strings.Repeat("0", 5-len(id)) + id
+}
+
+func now() string {
+	return time.Now().UTC().Format(time.RFC3339)
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r.URL.Path == "/token" {
+		s.token(w, r)
+		return
+	}
+	if !s.authorized(r) {
+		writeError(w, errorf(http.StatusUnauthorized, "unauthorized", "Missing or invalid access token"))
+		return
+	}
+	if !strings.HasPrefix(r.URL.Path, "/1.0/") {
+		writeError(w, errorf(http.StatusNotFound, "missing_resource", "No such path %s", r.URL.Path))
+		return
+	}
+	status, body, err := s.route(w, r, strings.Split(strings.Trim(r.URL.Path[len("/1.0/"):], "/"), "/"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if body != nil {
+		json.NewEncoder(w).Encode(body)
+	}
+}
+
+func (s *Server) route(w http.ResponseWriter, r *http.Request, path []string) (int, interface{}, *apiError) {
+	if len(path) == 2 && path[0] == "user" && path[1] == "collaborations" {
+		return http.StatusOK, []interface{}{}, nil
+	}
+	k, ok := kinds[path[0]]
+	if !ok {
+		return 0, nil, errorf(http.StatusNotFound, "missing_resource", "No such path %s", r.URL.Path)
+	}
+	var body resource
+	if r.Method == "POST" || r.Method == "PUT" {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil && err.Error() != "EOF" {
+			return 0, nil, errorf(http.StatusBadRequest, "invalid_json", "Can't parse the request body: %s", err.Error())
+		}
+		if body == nil {
+			body = resource{}
+		}
+	}
+
+	switch {
+	case len(path) == 1 && r.Method == "GET":
+		return http.StatusOK, s.list(k), nil
+	case len(path) == 1 && r.Method == "POST":
+		res, err := s.create(k, body)
+		if err != nil {
+			return 0, nil, err
+		}
+		return http.StatusCreated, s.render(k, res), nil
+	case len(path) > 3:
+		return 0, nil, errorf(http.StatusNotFound, "missing_resource", "No such path %s", r.URL.Path)
+	}
+
+	res, err := s.find(k, path[1])
+	if err != nil {
+		return 0, nil, err
+	}
+	switch {
+	case len(path) == 2 && r.Method == "GET":
+		return http.StatusOK, s.render(k, res), nil
+	case len(path) == 2 && r.Method == "PUT":
+		if err := s.update(k, res, body); err != nil {
+			return 0, nil, err
+		}
+		return http.StatusOK, s.render(k, res), nil
+	case len(path) == 2 && r.Method == "DELETE":
+		if err := s.destroy(k, res); err != nil {
+			return 0, nil, err
+		}
+		return http.StatusAccepted, nil, nil
+	case len(path) == 3 && r.Method == "POST":
+		action, ok := k.actions[path[2]]
+		if !ok {
+			return 0, nil, errorf(http.StatusNotFound, "missing_resource", "No such path %s", r.URL.Path)
+		}
+		if err := action(s, w, res, body); err != nil {
+			return 0, nil, err
+		}
+		return http.StatusAccepted, s.render(k, res), nil
+	}
+	return 0, nil, errorf(http.StatusMethodNotAllowed, "method_not_allowed", "%s isn't supported on %s", r.Method, r.URL.Path)
+}
+
+func writeError(w http.ResponseWriter, err *apiError) {
+	w.Header().Set("Content-Type", "application/json")
+	if err.Status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+	}
+	w.WriteHeader(err.Status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error_name": err.Name,
+		"errors":     err.Errors,
+	})
+}
+
+func (s *Server) find(k *kind, id string) (resource, *apiError) {
+	res, ok := s.resources[k.name][id]
+	if !ok {
+		return nil, errorf(http.StatusNotFound, "missing_resource", "Resource with the identifier '%s' could not be found", id)
+	}
+	return res, nil
+}
+
+// sortedIds lists the identifiers in a collection in creation order
+func (s *Server) sortedIds(name string) []string {
+	ids := make([]string, 0, len(s.resources[name]))
+	for id := range s.resources[name] {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func (s *Server) list(k *kind) []resource {
+	list := []resource{}
+	for _, id := range s.sortedIds(k.name) {
+		list = append(list, s.render(k, s.resources[k.name][id]))
+	}
+	return list
+}
+
+// add stores a new resource of a kind, giving it an identifier if it has none
+func (s *Server) add(k *kind, res resource) resource {
+	if res["id"] == nil {
+		res["id"] = s.nextId(k.prefix)
+	}
+	res["resource_type"] = k.resourceType
+	s.resources[k.name][res["id"].(string)] = res
+	return res
+}
+
+func (s *Server) create(k *kind, body resource) (resource, *apiError) {
+	res := resource{"id": s.nextId(k.prefix), "created_at": now()}
+	if k.defaults != nil {
+		k.defaults(s, res)
+	}
+	if err := s.assign(k, res, body); err != nil {
+		return nil, err
+	}
+	if k.created != nil {
+		if err := k.created(s, res); err != nil {
+			return nil, err
+		}
+	}
+	return s.add(k, res), nil
+}
+
+func (s *Server) update(k *kind, res resource, body resource) *apiError {
+	return s.assign(k, res, body)
+}
+
+// assign sets the fields given in a request body on a resource. Fields
+// referring to other resources must name ones that exist.
+func (s *Server) assign(k *kind, res resource, body resource) *apiError {
+	for field, value := range body {
+		if field == "id" || field == "resource_type" || strings.HasPrefix(field, "_") {
+			continue
+		}
+		if alias, ok := k.aliases[field]; ok {
+			field = alias
+		}
+		ref, isRef := k.refs[field]
+		switch {
+		case !isRef:
+			res[field] = value
+		case ref.many:
+			ids, err := s.refIds(ref, value)
+			if err != nil {
+				return err
+			}
+			res[field] = ids
+		default:
+			id, _ := value.(string)
+			if id == "" {
+				delete(res, field)
+				continue
+			}
+			if _, ok := s.resources[ref.collection][id]; !ok {
+				return errorf(http.StatusUnprocessableEntity, "invalid_resource", "%s '%s' could not be found", field, id)
+			}
+			res[field] = id
+		}
+	}
+	return nil
+}
+
+// refIds reads a list of identifiers from a request, either as strings or as
+// objects such as {"server": "srv-xxxxx"}
+func (s *Server) refIds(ref reference, value interface{}) ([]string, *apiError) {
+	values, ok := value.([]interface{})
+	if !ok && value != nil {
+		return nil, errorf(http.StatusUnprocessableEntity, "invalid_resource", "Expected a list of identifiers")
+	}
+	ids := []string{}
+	for _, v := range values {
+		var id string
+		switch v := v.(type) {
+		case string:
+			id = v
+		case map[string]interface{}:
+			id, _ = v[ref.key].(string)
+		}
+		if _, ok := s.resources[ref.collection][id]; !ok {
+			return nil, errorf(http.StatusUnprocessableEntity, "invalid_resource", "'%s' could not be found", id)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func (s *Server) destroy(k *kind, res resource) *apiError {
+	if locked, _ := res["locked"].(bool); locked {
+		return errorf(http.StatusConflict, "resource_locked", "Resource %s is locked", res["id"])
+	}
+	if k.destroy != nil {
+		return k.destroy(s, k, res)
+	}
+	s.remove(k, res)
+	return nil
+}
+
+// remove deletes a resource, and any references other resources make to it
+func (s *Server) remove(k *kind, res resource) {
+	id := res["id"].(string)
+	delete(s.resources[k.name], id)
+	for name, referrer := range kinds {
+		for field, ref := range referrer.refs {
+			if ref.collection != k.name {
+				continue
+			}
+			for _, other := range s.resources[name] {
+				if ref.many {
+					ids, _ := other[field].([]string)
+					other[field] = without(ids, id)
+				} else if other[field] == id {
+					delete(other, field)
+				}
+			}
+		}
+	}
+}
+
+func without(ids []string, id string) []string {
+	kept := []string{}
+	for _, i := range ids {
+		if i != id {
+			kept = append(kept, i)
+		}
+	}
+	return kept
+}
+
+func contains(ids []string, id string) bool {
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+	return false
+}
+
+// render is a resource as the API returns it, with references expanded into
+// brief copies of the resources they refer to
+func (s *Server) render(k *kind, res resource) resource {
+	out := resource{}
+	for field, value := range res {
+		if strings.HasPrefix(field, "_") {
+			continue
+		}
+		ref, isRef := k.refs[field]
+		switch {
+		case !isRef:
+			out[field] = value
+		case ref.many:
+			briefs := []resource{}
+			for _, id := range value.([]string) {
+				briefs = append(briefs, s.brief(ref.collection, id))
+			}
+			out[field] = briefs
+		default:
+			out[field] = s.brief(ref.collection, value.(string))
+		}
+	}
+	for field, ref := range k.refs {
+		if _, ok := out[field]; !ok {
+			if ref.many {
+				out[field] = []resource{}
+			} else {
+				out[field] = nil
+			}
+		}
+	}
+	for field, back := range k.backrefs {
+		briefs := []resource{}
+		for _, id := range s.referrers(back, res["id"].(string)) {
+			briefs = append(briefs, s.brief(back.collection, id))
+		}
+		if back.single {
+			if len(briefs) > 0 {
+				out[field] = briefs[0]
+			} else {
+				out[field] = nil
+			}
+		} else {
+			out[field] = briefs
+		}
+	}
+	if k.rendering != nil {
+		k.rendering(s, res, out)
+	}
+	return out
+}
+
+// referrers lists the resources in a collection which refer to a resource
+func (s *Server) referrers(back backref, id string) []string {
+	var ids []string
+	for _, other := range s.sortedIds(back.collection) {
+		switch value := s.resources[back.collection][other][back.field].(type) {
+		case string:
+			if value == id {
+				ids = append(ids, other)
+			}
+		case []string:
+			if contains(value, id) {
+				ids = append(ids, other)
+			}
+		}
+	}
+	return ids
+}
+
+// brief is a resource as it appears nested in another: only its own simple
+// fields, without anything it refers to
+func (s *Server) brief(collection, id string) resource {
+	out := resource{}
+	for field, value := range s.resources[collection][id] {
+		if strings.HasPrefix(field, "_") {
+			continue
+		}
+		if _, isRef := kinds[collection].refs[field]; isRef {
+			continue
+		}
+		switch value.(type) {
+		case []interface{}, []string, []resource, map[string]interface{}, resource:
+			continue
+		}
+		out[field] = value
+	}
+	return out
+}
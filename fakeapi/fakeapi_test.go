@@ -0,0 +1,293 @@
+package fakeapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// apiClient makes requests to a fake API with a token from its /token endpoint
+type apiClient struct {
+	t     *testing.T
+	url   string
+	token string
+}
+
+func newAPIClient(t *testing.T) (*apiClient, func()) {
+	ts := httptest.NewServer(New())
+	c := &apiClient{t: t, url: ts.URL}
+	status, body := c.tokenRequest(url.Values{"grant_type": {"client_credentials"}, "client_id": {"cli-test1"}})
+	if status != http.StatusOK {
+		ts.Close()
+		t.Fatalf("token request failed with %d: %v", status, body)
+	}
+	c.token = body["access_token"].(string)
+	return c, ts.Close
+}
+
+func (c *apiClient) tokenRequest(form url.Values) (int, map[string]interface{}) {
+	res, err := http.PostForm(c.url+"/token", form)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	defer res.Body.Close()
+	var body map[string]interface{}
+	if err = json.NewDecoder(res.Body).Decode(&body); err != nil {
+		c.t.Fatal(err)
+	}
+	return res.StatusCode, body
+}
+
+// do makes an API request, returning the status and the decoded response body
+func (c *apiClient) do(method, path, body string) (int, interface{}) {
+	req, err := http.NewRequest(method, c.url+path, strings.NewReader(body))
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	defer res.Body.Close()
+	var decoded interface{}
+	if res.ContentLength != 0 {
+		json.NewDecoder(res.Body).Decode(&decoded)
+	}
+	return res.StatusCode, decoded
+}
+
+func (c *apiClient) get(path string) interface{} {
+	status, body := c.do("GET", path, "")
+	if status != http.StatusOK {
+		c.t.Fatalf("GET %s: got status %d: %v", path, status, body)
+	}
+	return body
+}
+
+func ids(list interface{}) []string {
+	var ids []string
+	for _, r := range list.([]interface{}) {
+		ids = append(ids, r.(map[string]interface{})["id"].(string))
+	}
+	return ids
+}
+
+func TestToken(t *testing.T) {
+	c := &apiClient{t: t}
+	ts := httptest.NewServer(New())
+	defer ts.Close()
+	c.url = ts.URL
+
+	tests := []struct {
+		name    string
+		form    url.Values
+		status  int
+		refresh bool
+	}{
+		{"client credentials", url.Values{"grant_type": {"client_credentials"}, "client_id": {"cli-test1"}}, http.StatusOK, false},
+		{"password", url.Values{"grant_type": {"password"}, "client_id": {"app-test1"}, "username": {"user@example.com"}, "password": {"secret"}}, http.StatusOK, true},
+		{"refresh token", url.Values{"grant_type": {"refresh_token"}, "client_id": {"app-test1"}, "refresh_token": {"abc"}}, http.StatusOK, true},
+		{"no password", url.Values{"grant_type": {"password"}, "client_id": {"app-test1"}, "username": {"user@example.com"}}, http.StatusBadRequest, false},
+		{"no client", url.Values{"grant_type": {"client_credentials"}}, http.StatusUnauthorized, false},
+		{"unknown grant", url.Values{"grant_type": {"magic"}, "client_id": {"cli-test1"}}, http.StatusBadRequest, false},
+	}
+	for _, test := range tests {
+		status, body := c.tokenRequest(test.form)
+		if status != test.status {
+			t.Errorf("%s: got status %d, want %d: %v", test.name, status, test.status, body)
+			continue
+		}
+		if status != http.StatusOK {
+			if body["error"] == nil {
+				t.Errorf("%s: got no OAuth error in %v", test.name, body)
+			}
+			continue
+		}
+		if body["access_token"] == "" || body["token_type"] != "Bearer" || body["expires_in"] == nil {
+			t.Errorf("%s: got an incomplete token %v", test.name, body)
+		}
+		if _, ok := body["refresh_token"]; ok != test.refresh {
+			t.Errorf("%s: got refresh token %v, want %v", test.name, ok, test.refresh)
+		}
+	}
+}
+
+func TestTokenAddsAPIClient(t *testing.T) {
+	c, stop := newAPIClient(t)
+	defer stop()
+	client := c.get("/1.0/api_clients/cli-test1").(map[string]interface{})
+	if account := client["account"].(map[string]interface{}); account["id"] != AccountId {
+		t.Errorf("got API client account %v, want %s", account["id"], AccountId)
+	}
+}
+
+func TestUnauthorized(t *testing.T) {
+	c, stop := newAPIClient(t)
+	defer stop()
+	for _, token := range []string{"", "not-a-token"} {
+		c.token = token
+		status, body := c.do("GET", "/1.0/servers", "")
+		if status != http.StatusUnauthorized {
+			t.Errorf("token %q: got status %d, want 401: %v", token, status, body)
+		}
+	}
+}
+
+func TestList(t *testing.T) {
+	c, stop := newAPIClient(t)
+	defer stop()
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{"/1.0/servers", nil},
+		{"/1.0/zones", []string{"zon-fake1", "zon-fake2"}},
+		{"/1.0/server_types", []string{"typ-fake1", "typ-fake2", "typ-fake3"}},
+		{"/1.0/images", []string{"img-fake1"}},
+		{"/1.0/server_groups", []string{"grp-fake1"}},
+		{"/1.0/firewall_policies", []string{"fwp-fake1"}},
+		{"/1.0/accounts", []string{AccountId}},
+	}
+	for _, test := range tests {
+		got := ids(c.get(test.path))
+		if strings.Join(got, ",") != strings.Join(test.want, ",") {
+			t.Errorf("%s: got %v, want %v", test.path, got, test.want)
+		}
+	}
+}
+
+func TestCreate(t *testing.T) {
+	c, stop := newAPIClient(t)
+	defer stop()
+	status, body := c.do("POST", "/1.0/server_groups", `{"name":"web","description":"Web servers"}`)
+	if status != http.StatusCreated {
+		t.Fatalf("got status %d: %v", status, body)
+	}
+	group := body.(map[string]interface{})
+	groupId := group["id"].(string)
+	if !strings.HasPrefix(groupId, "grp-") || group["name"] != "web" || group["description"] != "Web servers" {
+		t.Errorf("got server group %v", group)
+	}
+
+	status, body = c.do("POST", "/1.0/servers", `{"name":"web-1","image":"img-fake1","server_type":"typ-fake2","server_groups":["`+groupId+`"]}`)
+	if status != http.StatusCreated {
+		t.Fatalf("got status %d: %v", status, body)
+	}
+	server := body.(map[string]interface{})
+	serverId := server["id"].(string)
+	if server["name"] != "web-1" || server["status"] != "active" {
+		t.Errorf("got server %v", server)
+	}
+	if image := server["image"].(map[string]interface{}); image["id"] != "img-fake1" {
+		t.Errorf("got image %v, want it expanded", server["image"])
+	}
+	if got := ids(server["server_groups"]); len(got) != 1 || got[0] != groupId {
+		t.Errorf("got server groups %v, want [%s]", got, groupId)
+	}
+
+	group = c.get("/1.0/server_groups/" + groupId).(map[string]interface{})
+	if got := ids(group["servers"]); len(got) != 1 || got[0] != serverId {
+		t.Errorf("got group servers %v, want [%s]", got, serverId)
+	}
+	if got := ids(c.get("/1.0/servers")); len(got) != 1 || got[0] != serverId {
+		t.Errorf("got servers %v, want [%s]", got, serverId)
+	}
+}
+
+func TestCreateErrors(t *testing.T) {
+	c, stop := newAPIClient(t)
+	defer stop()
+	tests := []struct {
+		path   string
+		body   string
+		status int
+	}{
+		{"/1.0/servers", `{"name":"no-image"}`, http.StatusUnprocessableEntity},
+		{"/1.0/servers", `{"image":"img-zzzzz"}`, http.StatusUnprocessableEntity},
+		{"/1.0/servers", `{"image":"img-fake1","server_groups":["grp-zzzzz"]}`, http.StatusUnprocessableEntity},
+		{"/1.0/servers", `{"image":`, http.StatusBadRequest},
+		{"/1.0/widgets", `{}`, http.StatusNotFound},
+	}
+	for _, test := range tests {
+		status, body := c.do("POST", test.path, test.body)
+		if status != test.status {
+			t.Errorf("POST %s %s: got status %d, want %d", test.path, test.body, status, test.status)
+			continue
+		}
+		if e, ok := body.(map[string]interface{}); !ok || e["error_name"] == nil || e["errors"] == nil {
+			t.Errorf("POST %s %s: got %v, want an API error", test.path, test.body, body)
+		}
+	}
+	if got := ids(c.get("/1.0/servers")); len(got) != 0 {
+		t.Errorf("failed requests created servers %v", got)
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	c, stop := newAPIClient(t)
+	defer stop()
+	_, body := c.do("POST", "/1.0/cloud_ips", `{"name":"ip"}`)
+	id := body.(map[string]interface{})["id"].(string)
+	status, body := c.do("PUT", "/1.0/cloud_ips/"+id, `{"reverse_dns":"www.example.com"}`)
+	if status != http.StatusOK {
+		t.Fatalf("got status %d: %v", status, body)
+	}
+	cip := c.get("/1.0/cloud_ips/" + id).(map[string]interface{})
+	if cip["name"] != "ip" || cip["reverse_dns"] != "www.example.com" {
+		t.Errorf("got Cloud IP %v", cip)
+	}
+}
+
+func TestDestroy(t *testing.T) {
+	c, stop := newAPIClient(t)
+	defer stop()
+	_, body := c.do("POST", "/1.0/servers", `{"image":"img-fake1"}`)
+	serverId := body.(map[string]interface{})["id"].(string)
+	_, body = c.do("POST", "/1.0/cloud_ips", `{}`)
+	cipId := body.(map[string]interface{})["id"].(string)
+	if status, body := c.do("POST", "/1.0/cloud_ips/"+cipId+"/map", `{"destination":"`+serverId+`"}`); status != http.StatusAccepted {
+		t.Fatalf("map: got status %d: %v", status, body)
+	}
+
+	if status, _ := c.do("DELETE", "/1.0/servers/"+serverId, ""); status != http.StatusAccepted {
+		t.Errorf("got status %d, want 202", status)
+	}
+	if status, _ := c.do("GET", "/1.0/servers/"+serverId, ""); status != http.StatusNotFound {
+		t.Errorf("got status %d for a destroyed server, want 404", status)
+	}
+	if status, _ := c.do("DELETE", "/1.0/servers/"+serverId, ""); status != http.StatusNotFound {
+		t.Errorf("got status %d destroying it again, want 404", status)
+	}
+	cip := c.get("/1.0/cloud_ips/" + cipId).(map[string]interface{})
+	if cip["status"] != "unmapped" || cip["server"] != nil {
+		t.Errorf("got Cloud IP %v, want it unmapped from the destroyed server", cip)
+	}
+
+	// Images are kept, as deleted
+	if status, _ := c.do("DELETE", "/1.0/images/img-fake1", ""); status != http.StatusAccepted {
+		t.Errorf("got status %d destroying an image, want 202", status)
+	}
+	if image := c.get("/1.0/images/img-fake1").(map[string]interface{}); image["status"] != "deleted" {
+		t.Errorf("got image status %v, want deleted", image["status"])
+	}
+}
+
+func TestDestroyErrors(t *testing.T) {
+	c, stop := newAPIClient(t)
+	defer stop()
+	if status, _ := c.do("DELETE", "/1.0/server_groups/grp-fake1", ""); status != http.StatusUnprocessableEntity {
+		t.Errorf("got status %d destroying the default group, want 422", status)
+	}
+	_, body := c.do("POST", "/1.0/servers", `{"image":"img-fake1"}`)
+	id := body.(map[string]interface{})["id"].(string)
+	c.do("POST", "/1.0/servers/"+id+"/lock_resource", "")
+	if status, _ := c.do("DELETE", "/1.0/servers/"+id, ""); status != http.StatusConflict {
+		t.Errorf("got status %d destroying a locked server, want 409", status)
+	}
+}
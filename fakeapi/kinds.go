@@ -0,0 +1,643 @@
+package fakeapi
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// reference describes a field holding the identifier of another resource, or
+// a list of them. In request bodies, list entries may be objects holding the
+// identifier under key, such as {"server": "srv-xxxxx"}.
+type reference struct {
+	collection string
+	many       bool
+	key        string
+}
+
+// backref describes a field listing the resources in another collection that
+// refer to a resource, such as the servers in a server group
+type backref struct {
+	collection string
+	field      string
+	single     bool
+}
+
+type action func(s *Server, w http.ResponseWriter, res resource, body resource) *apiError
+
+// kind describes a collection of resources, such as servers, and how they
+// differ from the generic create, update, destroy and render
+type kind struct {
+	name         string
+	prefix       string
+	resourceType string
+	refs         map[string]reference
+	aliases      map[string]string
+	backrefs     map[string]backref
+	defaults     func(s *Server, res resource)
+	created      func(s *Server, res resource) *apiError
+	destroy      func(s *Server, k *kind, res resource) *apiError
+	rendering    func(s *Server, res resource, out resource)
+	actions      map[string]action
+}
+
+var kinds map[string]*kind
+
+func init() {
+	kinds = map[string]*kind{
+		"accounts": {
+			prefix:       "acc",
+			resourceType: "account",
+			rendering:    renderAccount,
+		},
+		"api_clients": {
+			prefix:       "cli",
+			resourceType: "api_client",
+			refs:         map[string]reference{"account": {collection: "accounts"}},
+		},
+		"zones": {
+			prefix:       "zon",
+			resourceType: "zone",
+		},
+		"server_types": {
+			prefix:       "typ",
+			resourceType: "server_type",
+		},
+		"images": {
+			prefix:       "img",
+			resourceType: "image",
+			defaults:     imageDefaults,
+			destroy:      destroyImage,
+			actions:      lockActions,
+		},
+		"servers": {
+			prefix:       "srv",
+			resourceType: "server",
+			refs: map[string]reference{
+				"image":         {collection: "images"},
+				"server_type":   {collection: "server_types"},
+				"zone":          {collection: "zones"},
+				"server_groups": {collection: "server_groups", many: true, key: "group"},
+			},
+			backrefs: map[string]backref{
+				"cloud_ips": {collection: "cloud_ips", field: "server"},
+				"snapshots": {collection: "images", field: "_server"},
+			},
+			defaults: serverDefaults,
+			created:  createdServer,
+			actions: map[string]action{
+				"start":            setStatus("active"),
+				"stop":             setStatus("inactive"),
+				"shutdown":         setStatus("inactive"),
+				"reboot":           setStatus("active"),
+				"reset":            setStatus("active"),
+				"lock_resource":    setLocked(true),
+				"unlock_resource":  setLocked(false),
+				"snapshot":         snapshotServer,
+				"activate_console": activateConsole,
+			},
+		},
+		"server_groups": {
+			prefix:       "grp",
+			resourceType: "server_group",
+			backrefs: map[string]backref{
+				"servers":         {collection: "servers", field: "server_groups"},
+				"firewall_policy": {collection: "firewall_policies", field: "server_group", single: true},
+			},
+			defaults: serverGroupDefaults,
+			destroy:  destroyServerGroup,
+			actions: map[string]action{
+				"add_servers":    addServers,
+				"remove_servers": removeServers,
+				"move_servers":   moveServers,
+			},
+		},
+		"cloud_ips": {
+			prefix:       "cip",
+			resourceType: "cloud_ip",
+			refs: map[string]reference{
+				"server":          {collection: "servers"},
+				"server_group":    {collection: "server_groups"},
+				"load_balancer":   {collection: "load_balancers"},
+				"database_server": {collection: "database_servers"},
+			},
+			defaults:  cloudIPDefaults,
+			rendering: renderCloudIP,
+			actions: map[string]action{
+				"map":   mapCloudIP,
+				"unmap": unmapCloudIP,
+			},
+		},
+		"firewall_policies": {
+			prefix:       "fwp",
+			resourceType: "firewall_policy",
+			refs:         map[string]reference{"server_group": {collection: "server_groups"}},
+			backrefs:     map[string]backref{"rules": {collection: "firewall_rules", field: "firewall_policy"}},
+			defaults:     firewallPolicyDefaults,
+			destroy:      destroyFirewallPolicy,
+			actions: map[string]action{
+				"apply_to": applyFirewallPolicy,
+				"remove":   removeFirewallPolicy,
+			},
+		},
+		"firewall_rules": {
+			prefix:       "fwr",
+			resourceType: "firewall_rule",
+			refs:         map[string]reference{"firewall_policy": {collection: "firewall_policies"}},
+			created:      createdFirewallRule,
+		},
+		"load_balancers": {
+			prefix:       "lba",
+			resourceType: "load_balancer",
+			refs:         map[string]reference{"nodes": {collection: "servers", many: true, key: "node"}},
+			backrefs:     map[string]backref{"cloud_ips": {collection: "cloud_ips", field: "load_balancer"}},
+			defaults:     loadBalancerDefaults,
+			actions: map[string]action{
+				"add_nodes":       addNodes,
+				"remove_nodes":    removeNodes,
+				"lock_resource":   setLocked(true),
+				"unlock_resource": setLocked(false),
+			},
+		},
+		"database_servers": {
+			prefix:       "dbs",
+			resourceType: "database_server",
+			refs: map[string]reference{
+				"zone":                 {collection: "zones"},
+				"database_server_type": {collection: "database_types"},
+			},
+			aliases:   map[string]string{"database_type": "database_server_type"},
+			backrefs:  map[string]backref{"cloud_ips": {collection: "cloud_ips", field: "database_server"}},
+			defaults:  databaseServerDefaults,
+			rendering: renderDatabaseServer,
+			actions: map[string]action{
+				"reset_password":  resetDatabasePassword,
+				"snapshot":        snapshotDatabaseServer,
+				"lock_resource":   setLocked(true),
+				"unlock_resource": setLocked(false),
+			},
+		},
+		"database_snapshots": {
+			prefix:       "dbi",
+			resourceType: "database_snapshot",
+			actions:      lockActions,
+		},
+		"database_types": {
+			prefix:       "dbt",
+			resourceType: "database_type",
+		},
+	}
+	for name, k := range kinds {
+		k.name = name
+	}
+}
+
+// seed adds the resources every account starts with
+func (s *Server) seed() {
+	s.add(kinds["accounts"], resource{
+		"id":                   AccountId,
+		"name":                 "Fake account",
+		"status":               "active",
+		"created_at":           now(),
+		"ram_limit":            65536,
+		"cloud_ips_limit":      5,
+		"load_balancers_limit": 5,
+		"dbs_ram_limit":        8192,
+		"library_ftp_host":     "ftp.library.gb1.brightbox.com",
+		"library_ftp_user":     AccountId,
+		"library_ftp_password": nil,
+	})
+	for i, handle := range []string{"gb1-a", "gb1-b"} {
+		s.add(kinds["zones"], resource{"id": fmt.Sprintf("zon-fake%d", i+1), "handle": handle})
+	}
+	for i, ram := range []int{1024, 2048, 4096} {
+		s.add(kinds["server_types"], resource{
+			"id":        fmt.Sprintf("typ-fake%d", i+1),
+			"name":      fmt.Sprintf("%dGB SSD", ram/1024),
+			"handle":    fmt.Sprintf("%dgb.ssd", ram/1024),
+			"status":    "available",
+			"cores":     ram / 1024,
+			"ram":       ram,
+			"disk_size": ram * 30,
+		})
+	}
+	s.add(kinds["images"], resource{
+		"id":                 "img-fake1",
+		"name":               "ubuntu-jammy-22.04-amd64-server",
+		"description":        "Ubuntu Jammy 22.04 server",
+		"username":           "ubuntu",
+		"status":             "available",
+		"source":             "ubuntu-jammy-22.04-amd64-server.img",
+		"source_type":        "upload",
+		"arch":               "x86_64",
+		"official":           true,
+		"public":             true,
+		"owner":              "acc-brbox",
+		"compatibility_mode": false,
+		"locked":             false,
+		"virtual_size":       2252,
+		"disk_size":          2252,
+		"created_at":         now(),
+	})
+	s.add(kinds["database_types"], resource{
+		"id":          "dbt-fake1",
+		"name":        "SSD 1GB",
+		"description": "1GB RAM, 20GB SSD",
+		"ram":         1024,
+		"disk_size":   20480,
+	})
+	s.add(kinds["server_groups"], resource{
+		"id":          "grp-fake1",
+		"name":        "default",
+		"description": "All new servers are added to this group unless specified otherwise.",
+		"default":     true,
+		"fqdn":        "grp-fake1.gb1.brightbox.com",
+		"created_at":  now(),
+	})
+	s.add(kinds["firewall_policies"], resource{
+		"id":           "fwp-fake1",
+		"name":         "default",
+		"description":  "",
+		"default":      true,
+		"server_group": "grp-fake1",
+		"created_at":   now(),
+	})
+	for _, rule := range []resource{
+		{"destination": "any", "description": "Outbound"},
+		{"source": "any", "protocol": "tcp", "destination_port": "22", "description": "SSH"},
+		{"source": "any", "protocol": "icmp", "icmp_type_name": "any", "description": "ICMP"},
+	} {
+		rule["firewall_policy"] = "fwp-fake1"
+		rule["created_at"] = now()
+		s.add(kinds["firewall_rules"], rule)
+	}
+}
+
+func renderAccount(s *Server, res resource, out resource) {
+	ram := 0
+	for _, srv := range s.resources["servers"] {
+		if t, ok := s.resources["server_types"][srv["server_type"].(string)]; ok {
+			ram += t["ram"].(int)
+		}
+	}
+	out["ram_used"] = ram
+	out["cloud_ips_used"] = len(s.resources["cloud_ips"])
+	out["load_balancers_used"] = len(s.resources["load_balancers"])
+}
+
+func imageDefaults(s *Server, res resource) {
+	res["status"] = "available"
+	res["owner"] = AccountId
+	res["official"] = false
+	res["public"] = false
+	res["locked"] = false
+	res["arch"] = "x86_64"
+	res["compatibility_mode"] = false
+}
+
+// Images are kept once destroyed, as servers built from them still refer to
+// them
+func destroyImage(s *Server, k *kind, res resource) *apiError {
+	res["status"] = "deleted"
+	return nil
+}
+
+var lockActions = map[string]action{
+	"lock_resource":   setLocked(true),
+	"unlock_resource": setLocked(false),
+}
+
+func setLocked(locked bool) action {
+	return func(s *Server, w http.ResponseWriter, res resource, body resource) *apiError {
+		res["locked"] = locked
+		return nil
+	}
+}
+
+func setStatus(status string) action {
+	return func(s *Server, w http.ResponseWriter, res resource, body resource) *apiError {
+		if status == "active" && res["status"] != "active" {
+			res["started_at"] = now()
+		}
+		res["status"] = status
+		return nil
+	}
+}
+
+func serverDefaults(s *Server, res resource) {
+	id := res["id"].(string)
+	res["status"] = "active"
+	res["locked"] = false
+	res["name"] = ""
+	res["hostname"] = id
+	res["fqdn"] = id + ".gb1.brightbox.com"
+	res["started_at"] = now()
+	res["deleted_at"] = nil
+	res["user_data"] = ""
+	res["compatibility_mode"] = false
+	res["server_type"] = "typ-fake1"
+	res["zone"] = "zon-fake1"
+	res["server_groups"] = []string{"grp-fake1"}
+	res["interfaces"] = []resource{{
+		"id":            "int-" + id[4:],
+		"resource_type": "interface",
+		"ipv4_address":  fmt.Sprintf("10.240.%d.%d", s.seq/250%250, s.seq%250+2),
+		"ipv6_address":  fmt.Sprintf("2a02:1348:17c:%x::1", s.seq),
+		"mac_address":   fmt.Sprintf("02:24:19:00:%02x:%02x", s.seq/256%256, s.seq%256),
+	}}
+}
+
+func createdServer(s *Server, res resource) *apiError {
+	if res["image"] == nil {
+		return errorf(http.StatusUnprocessableEntity, "invalid_resource", "An image is required")
+	}
+	return nil
+}
+
+// serverInterface finds the server with an interface
+func (s *Server) serverInterface(id string) (resource, resource) {
+	for _, srv := range s.resources["servers"] {
+		for _, iface := range srv["interfaces"].([]resource) {
+			if iface["id"] == id {
+				return srv, iface
+			}
+		}
+	}
+	return nil, nil
+}
+
+func snapshotServer(s *Server, w http.ResponseWriter, res resource, body resource) *apiError {
+	image := resource{
+		"id":          s.nextId("img"),
+		"name":        fmt.Sprintf("Snapshot of %s", res["id"]),
+		"description": "",
+		"source":      res["id"],
+		"source_type": "snapshot",
+		"created_at":  now(),
+		"_server":     res["id"],
+	}
+	imageDefaults(s, image)
+	if source, ok := s.resources["images"][res["image"].(string)]; ok {
+		image["username"] = source["username"]
+		image["arch"] = source["arch"]
+	}
+	s.add(kinds["images"], image)
+	w.Header().Set("Link", fmt.Sprintf(`</1.0/images/%s>; rel="snapshot"`, image["id"]))
+	return nil
+}
+
+func activateConsole(s *Server, w http.ResponseWriter, res resource, body resource) *apiError {
+	res["console_url"] = "https://console.gb1.brightbox.com/?token=" + randomHex(8)
+	res["console_token"] = randomHex(8)
+	res["console_token_expires"] = now()
+	return nil
+}
+
+func serverGroupDefaults(s *Server, res resource) {
+	res["name"] = ""
+	res["description"] = ""
+	res["default"] = false
+	res["fqdn"] = res["id"].(string) + ".gb1.brightbox.com"
+}
+
+func destroyServerGroup(s *Server, k *kind, res resource) *apiError {
+	if res["default"] == true {
+		return errorf(http.StatusUnprocessableEntity, "invalid_resource", "The default server group can't be destroyed")
+	}
+	s.remove(k, res)
+	return nil
+}
+
+var serverList = reference{collection: "servers", many: true, key: "server"}
+
+func addServers(s *Server, w http.ResponseWriter, res resource, body resource) *apiError {
+	ids, err := s.refIds(serverList, body["servers"])
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		srv := s.resources["servers"][id]
+		groups := srv["server_groups"].([]string)
+		if !contains(groups, res["id"].(string)) {
+			srv["server_groups"] = append(groups, res["id"].(string))
+		}
+	}
+	return nil
+}
+
+func removeServers(s *Server, w http.ResponseWriter, res resource, body resource) *apiError {
+	ids, err := s.refIds(serverList, body["servers"])
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		srv := s.resources["servers"][id]
+		srv["server_groups"] = without(srv["server_groups"].([]string), res["id"].(string))
+	}
+	return nil
+}
+
+func moveServers(s *Server, w http.ResponseWriter, res resource, body resource) *apiError {
+	dest, _ := body["destination"].(string)
+	destination, err := s.find(kinds["server_groups"], dest)
+	if err != nil {
+		return err
+	}
+	if err := removeServers(s, w, res, body); err != nil {
+		return err
+	}
+	return addServers(s, w, destination, body)
+}
+
+func cloudIPDefaults(s *Server, res resource) {
+	id := res["id"].(string)
+	ip := fmt.Sprintf("109.107.%d.%d", s.seq/250%250, s.seq%250+2)
+	res["name"] = ""
+	res["public_ip"] = ip
+	res["public_ipv4"] = ip
+	res["public_ipv6"] = fmt.Sprintf("2a02:1348:ffff:ffff::6d6b:%x", s.seq)
+	res["reverse_dns"] = "cip-" + id[4:] + ".gb1.brightbox.com"
+	res["fqdn"] = id + ".gb1.brightbox.com"
+	res["port_translators"] = []interface{}{}
+}
+
+var cloudIPDestinations = []string{"server", "server_group", "load_balancer", "database_server"}
+
+func renderCloudIP(s *Server, res resource, out resource) {
+	out["status"] = "unmapped"
+	out["interface"] = nil
+	for _, field := range cloudIPDestinations {
+		if res[field] != nil {
+			out["status"] = "mapped"
+		}
+	}
+	if id, ok := res["server"].(string); ok {
+		out["interface"] = s.resources["servers"][id]["interfaces"].([]resource)[0]
+	}
+}
+
+// mapCloudIP maps a Cloud IP to a server, by the server or its interface, or
+// to a server group, load balancer or database server
+func mapCloudIP(s *Server, w http.ResponseWriter, res resource, body resource) *apiError {
+	for _, field := range cloudIPDestinations {
+		if res[field] != nil {
+			return errorf(http.StatusUnprocessableEntity, "invalid_resource", "Cloud IP %s is already mapped", res["id"])
+		}
+	}
+	dest, _ := body["destination"].(string)
+	if srv, _ := s.serverInterface(dest); srv != nil {
+		dest = srv["id"].(string)
+	}
+	for _, field := range cloudIPDestinations {
+		k := kinds[kinds["cloud_ips"].refs[field].collection]
+		if len(dest) > 4 && dest[:4] == k.prefix+"-" {
+			if _, err := s.find(k, dest); err != nil {
+				return err
+			}
+			res[field] = dest
+			return nil
+		}
+	}
+	return errorf(http.StatusUnprocessableEntity, "invalid_resource", "Can't map a Cloud IP to '%s'", dest)
+}
+
+func unmapCloudIP(s *Server, w http.ResponseWriter, res resource, body resource) *apiError {
+	for _, field := range cloudIPDestinations {
+		delete(res, field)
+	}
+	return nil
+}
+
+func firewallPolicyDefaults(s *Server, res resource) {
+	res["name"] = ""
+	res["description"] = ""
+	res["default"] = false
+}
+
+func destroyFirewallPolicy(s *Server, k *kind, res resource) *apiError {
+	for _, id := range s.referrers(k.backrefs["rules"], res["id"].(string)) {
+		s.remove(kinds["firewall_rules"], s.resources["firewall_rules"][id])
+	}
+	s.remove(k, res)
+	return nil
+}
+
+func applyFirewallPolicy(s *Server, w http.ResponseWriter, res resource, body resource) *apiError {
+	id, _ := body["server_group"].(string)
+	if _, err := s.find(kinds["server_groups"], id); err != nil {
+		return err
+	}
+	for _, other := range s.resources["firewall_policies"] {
+		if other["server_group"] == id {
+			return errorf(http.StatusUnprocessableEntity, "invalid_resource", "Server group %s already has a firewall policy", id)
+		}
+	}
+	res["server_group"] = id
+	return nil
+}
+
+func removeFirewallPolicy(s *Server, w http.ResponseWriter, res resource, body resource) *apiError {
+	delete(res, "server_group")
+	return nil
+}
+
+func createdFirewallRule(s *Server, res resource) *apiError {
+	if res["firewall_policy"] == nil {
+		return errorf(http.StatusUnprocessableEntity, "invalid_resource", "A firewall policy is required")
+	}
+	return nil
+}
+
+func loadBalancerDefaults(s *Server, res resource) {
+	res["name"] = ""
+	res["status"] = "active"
+	res["locked"] = false
+	res["policy"] = "least-connections"
+	res["buffer_size"] = 4096
+	res["https_redirect"] = false
+	res["ssl_minimum_version"] = "TLSv1.2"
+	res["certificate"] = nil
+	res["nodes"] = []string{}
+	res["listeners"] = []interface{}{
+		map[string]interface{}{"protocol": "http", "in": 80, "out": 80, "timeout": 50000},
+	}
+	res["healthcheck"] = map[string]interface{}{
+		"type": "http", "port": 80, "request": "/", "interval": 5000, "timeout": 5000,
+		"threshold_up": 3, "threshold_down": 3,
+	}
+}
+
+var nodeList = reference{collection: "servers", many: true, key: "node"}
+
+func addNodes(s *Server, w http.ResponseWriter, res resource, body resource) *apiError {
+	ids, err := s.refIds(nodeList, body["nodes"])
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if !contains(res["nodes"].([]string), id) {
+			res["nodes"] = append(res["nodes"].([]string), id)
+		}
+	}
+	return nil
+}
+
+func removeNodes(s *Server, w http.ResponseWriter, res resource, body resource) *apiError {
+	ids, err := s.refIds(nodeList, body["nodes"])
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		res["nodes"] = without(res["nodes"].([]string), id)
+	}
+	return nil
+}
+
+// Database servers only show their admin password when they are created, or
+// when it is reset
+func databaseServerDefaults(s *Server, res resource) {
+	res["name"] = ""
+	res["description"] = ""
+	res["status"] = "active"
+	res["locked"] = false
+	res["database_engine"] = "mysql"
+	res["database_version"] = "8.0"
+	res["admin_username"] = "admin"
+	res["_admin_password"] = randomHex(8)
+	res["_reveal_password"] = true
+	res["allow_access"] = []interface{}{}
+	res["maintenance_weekday"] = 0
+	res["maintenance_hour"] = 6
+	res["snapshots_schedule"] = nil
+	res["zone"] = "zon-fake1"
+	res["database_server_type"] = "dbt-fake1"
+}
+
+func renderDatabaseServer(s *Server, res resource, out resource) {
+	out["admin_password"] = nil
+	if res["_reveal_password"] == true {
+		out["admin_password"] = res["_admin_password"]
+		delete(res, "_reveal_password")
+	}
+}
+
+func resetDatabasePassword(s *Server, w http.ResponseWriter, res resource, body resource) *apiError {
+	res["_admin_password"] = randomHex(8)
+	res["_reveal_password"] = true
+	return nil
+}
+
+func snapshotDatabaseServer(s *Server, w http.ResponseWriter, res resource, body resource) *apiError {
+	snapshot := s.add(kinds["database_snapshots"], resource{
+		"id":               s.nextId("dbi"),
+		"name":             fmt.Sprintf("Snapshot of %s", res["id"]),
+		"description":      "",
+		"status":           "available",
+		"locked":           false,
+		"database_engine":  res["database_engine"],
+		"database_version": res["database_version"],
+		"size":             1024,
+		"created_at":       now(),
+	})
+	w.Header().Set("Link", fmt.Sprintf(`</1.0/database_snapshots/%s>; rel="snapshot"`, snapshot["id"]))
+	return nil
+}
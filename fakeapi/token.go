@@ -0,0 +1,88 @@
+package fakeapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// token issues access tokens for any client credentials, with the
+// client_credentials, password and refresh_token grants. API clients that
+// ask for tokens are added to the account, so they can be looked up.
+func (s *Server) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		writeOAuthError(w, http.StatusMethodNotAllowed, "invalid_request")
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request")
+		return
+	}
+	clientId, _, ok := r.BasicAuth()
+	if !ok {
+		clientId = r.PostForm.Get("client_id")
+	}
+	if clientId == "" {
+		writeOAuthError(w, http.StatusUnauthorized, "invalid_client")
+		return
+	}
+
+	refresh := false
+	switch r.PostForm.Get("grant_type") {
+	case "client_credentials":
+	case "password":
+		if r.PostForm.Get("username") == "" || r.PostForm.Get("password") == "" {
+			writeOAuthError(w, http.StatusBadRequest, "invalid_grant")
+			return
+		}
+		refresh = true
+	case "refresh_token":
+		if r.PostForm.Get("refresh_token") == "" {
+			writeOAuthError(w, http.StatusBadRequest, "invalid_grant")
+			return
+		}
+		refresh = true
+	default:
+		writeOAuthError(w, http.StatusBadRequest, "unsupported_grant_type")
+		return
+	}
+
+	if strings.HasPrefix(clientId, "cli-") && s.resources["api_clients"][clientId] == nil {
+		s.add(kinds["api_clients"], resource{
+			"id":                clientId,
+			"name":              "Fake API client",
+			"description":       "",
+			"permissions_group": "full",
+			"account":           AccountId,
+		})
+	}
+
+	accessToken := randomHex(16)
+	s.tokens[accessToken] = time.Now().Add(tokenLifetime)
+	body := map[string]interface{}{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   int(tokenLifetime.Seconds()),
+	}
+	if refresh {
+		body["refresh_token"] = randomHex(16)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(body)
+}
+
+func (s *Server) authorized(r *http.Request) bool {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return false
+	}
+	expires, ok := s.tokens[strings.TrimPrefix(auth, "Bearer ")]
+	return ok && time.Now().Before(expires)
+}
+
+func writeOAuthError(w http.ResponseWriter, status int, name string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": name})
+}
@@ -8,5 +8,9 @@ import (
 
 func main() {
 	cliapp := cli.New()
-	kingpin.MustParse(cliapp.Parse(os.Args[1:]))
+	command, err := cliapp.Parse(os.Args[1:])
+	if status, ok := err.(cli.ExitStatus); ok {
+		os.Exit(int(status))
+	}
+	kingpin.MustParse(command, err)
 }